@@ -0,0 +1,44 @@
+package updater
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Annotation is a note attached to the update log of the target device, e.g.
+// the ticket number or commit of a deployment.
+type Annotation struct {
+	Text string    `json:"annotation"`
+	Time time.Time `json:"time"`
+}
+
+// Annotate stores annotation (e.g. "deployed abc123 by ci-bot") in the update
+// log of the target device.
+func (t *Target) Annotate(ctx context.Context, annotation string) error {
+	return t.doJSON(ctx, "POST", "update/annotations", Annotation{
+		Text: annotation,
+		Time: time.Now(),
+	}, nil)
+}
+
+// GetAnnotations returns the most recent limit annotations stored on the target
+// device (all of them if limit is 0), newest first.
+func (t *Target) GetAnnotations(ctx context.Context, limit int) ([]Annotation, error) {
+	path := "update/annotations"
+	if limit > 0 {
+		path += "?limit=" + strconv.Itoa(limit)
+	}
+	var annotations []Annotation
+	if err := t.doJSON(ctx, "GET", path, nil, &annotations); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(annotations, func(i, j int) bool {
+		return annotations[i].Time.After(annotations[j].Time)
+	})
+	if limit > 0 && len(annotations) > limit {
+		annotations = annotations[:limit]
+	}
+	return annotations, nil
+}
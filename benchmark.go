@@ -0,0 +1,56 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// BenchmarkResult is the result of BenchmarkFlash.
+type BenchmarkResult struct {
+	BytesWritten   int64
+	Duration       time.Duration
+	ThroughputMBps float64 // megabytes (10⁶ bytes) per second
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// BenchmarkFlash measures the update throughput to dest by streaming
+// sizeBytes zero bytes to the target, which discards them instead of writing
+// them to the partition.
+func (t *Target) BenchmarkFlash(ctx context.Context, dest string, sizeBytes int64) (BenchmarkResult, error) {
+	if !t.Supports(ProtocolFeatureBenchmark) {
+		return BenchmarkResult{}, ErrUpdateHandlerNotImplemented
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, t.baseURL+"update/"+dest+"/benchmark", io.LimitReader(zeroReader{}, sizeBytes))
+	if err != nil {
+		return BenchmarkResult{}, err
+	}
+	req.ContentLength = sizeBytes
+	start := time.Now()
+	resp, err := t.httpDoer().Do(req)
+	if err != nil {
+		return BenchmarkResult{}, err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if got, want := resp.StatusCode, http.StatusOK; got != want {
+		return BenchmarkResult{}, fmt.Errorf("unexpected HTTP status code: got %d, want %d (body %q)", got, want, string(body))
+	}
+	duration := time.Since(start)
+	return BenchmarkResult{
+		BytesWritten:   sizeBytes,
+		Duration:       duration,
+		ThroughputMBps: float64(sizeBytes) / 1e6 / duration.Seconds(),
+	}, nil
+}
@@ -0,0 +1,60 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// ErrBlobNotCached is returned by StreamToCA when the content-addressed cache
+// does not contain the requested blob. Callers should fall back to StreamTo.
+var ErrBlobNotCached = errors.New("blob not in content-addressed cache")
+
+// HasBlob returns whether the content-addressed cache of the target contains a
+// blob with the specified digest (e.g. sha256:9f86d0…).
+func (t *Target) HasBlob(ctx context.Context, digest string) (bool, error) {
+	if !t.Supports(ProtocolFeatureContentAddressable) {
+		return false, ErrUpdateHandlerNotImplemented
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, t.baseURL+"blobs/"+url.PathEscape(digest), nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := t.httpDoer().Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected HTTP status code: got %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+// StreamToCA makes the target copy the blob with the specified digest from its
+// content-addressed cache to dest (see StreamTo), so that an image shared by
+// many devices does not need to be transferred over the network to each of
+// them. ErrBlobNotCached is returned if the blob is not cached.
+func (t *Target) StreamToCA(ctx context.Context, dest string, digest string) error {
+	cached, err := t.HasBlob(ctx, digest)
+	if err != nil {
+		return err
+	}
+	if !cached {
+		return ErrBlobNotCached
+	}
+	return t.doUpdateJSON(ctx, "POST", "update/"+dest+"/ca", struct {
+		Digest string `json:"digest"`
+	}{
+		Digest: digest,
+	}, nil)
+}
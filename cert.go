@@ -0,0 +1,45 @@
+package updater
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// GetCertificate connects to the target via TLS and returns the leaf
+// certificate it presents, e.g. to check its expiry or Subject Alternative
+// Names. The certificate is not verified, so that expired or self-signed
+// certificates can be inspected, too.
+func (t *Target) GetCertificate(ctx context.Context) (*x509.Certificate, error) {
+	u, err := url.Parse(t.baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("target is not accessed via https (base URL scheme %q)", u.Scheme)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+	dialer := &tls.Dialer{
+		Config: &tls.Config{
+			ServerName: u.Hostname(),
+			// Only the certificate is inspected, no data is exchanged.
+			InsecureSkipVerify: true,
+		},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("target presented no certificate")
+	}
+	return certs[0], nil
+}
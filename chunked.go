@@ -0,0 +1,87 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// readerSize returns the total size of r’s content, if known, or -1.
+func readerSize(r io.Reader) int64 {
+	switch r := r.(type) {
+	case interface{ Size() int64 }: // e.g. *bytes.Reader, *strings.Reader
+		return r.Size()
+	case interface{ Len() int }: // e.g. *bytes.Buffer
+		return int64(r.Len())
+	}
+	return -1
+}
+
+// StreamToChunked is like StreamTo, but sends the content in chunks of
+// chunkSize bytes, each in its own request carrying the CRC32 of the chunk, so
+// that targets with little RAM do not need to buffer the whole image. Once all
+// chunks are sent, the target verifies the hash of the complete content.
+func (t *Target) StreamToChunked(ctx context.Context, dest string, r io.Reader, chunkSize int) error {
+	if !t.Supports(ProtocolFeatureChunkedUpload) {
+		return ErrUpdateHandlerNotImplemented
+	}
+	if chunkSize <= 0 {
+		return fmt.Errorf("invalid chunk size %d", chunkSize)
+	}
+	start := time.Now()
+	total := readerSize(r)
+	hash := t.newUpdateHash()
+	buf := make([]byte, chunkSize)
+	var offset int64
+	for {
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		chunk := buf[:n]
+		hash.Write(chunk)
+		v := url.Values{}
+		v.Set("offset", strconv.FormatInt(offset, 10))
+		if total > -1 {
+			v.Set("total", strconv.FormatInt(total, 10))
+		}
+		req, err := t.newUpdateRequest(ctx, http.MethodPut, dest+"/chunk?"+v.Encode(), bytes.NewReader(chunk), int64(n))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("X-Gokrazy-Update-Hash", "crc32")
+		crc := crc32.ChecksumIEEE(chunk)
+		if err := t.doUpdate(req, func(b []byte) []byte {
+			return append(b, byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc))
+		}); err != nil {
+			return fmt.Errorf("chunk at offset %d: %w", offset, err)
+		}
+		offset += int64(n)
+		if n < chunkSize {
+			break
+		}
+	}
+
+	err := t.doUpdateJSON(ctx, "POST", "update/"+dest+"/finalize", struct {
+		Total int64  `json:"total"`
+		Hash  string `json:"hash"`
+	}{
+		Total: offset,
+		Hash:  hex.EncodeToString(hash.Sum(nil)),
+	}, nil)
+	if err != nil {
+		return err
+	}
+	t.metrics.recordUpdate(start)
+	return nil
+}
@@ -0,0 +1,199 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// ConnectivityStatus is the outcome of a ConnectivityStep.
+type ConnectivityStatus string
+
+// Possible ConnectivityStatus values.
+const (
+	ConnectivityOK      ConnectivityStatus = "ok"
+	ConnectivityFailed  ConnectivityStatus = "failed"
+	ConnectivitySkipped ConnectivityStatus = "skipped" // an earlier step failed, or not applicable
+)
+
+// ConnectivityStep is one of the checks performed by TestConnectivity.
+type ConnectivityStep struct {
+	Name   string // e.g. "DNS resolution"
+	Status ConnectivityStatus
+	Err    error // non-nil if Status is ConnectivityFailed
+}
+
+// ConnectivityReport is the result of TestConnectivity.
+type ConnectivityReport struct {
+	Steps []ConnectivityStep
+
+	// Recommendation describes how to fix the first failing step, or is
+	// empty if all steps succeeded.
+	Recommendation string
+}
+
+// TestConnectivity diagnoses why requests to the target fail by running
+// escalating checks: resolving the host name of the base URL, connecting via
+// TCP, an HTTP request without and with authentication, and the protocol
+// feature negotiation. Steps after the first failing step are skipped.
+//
+// The DNS and TCP checks are also skipped when the HTTPDoer does not connect to
+// the base URL host directly (e.g. with WithUnixSocket, a custom dialer or an
+// HTTP proxy), as they would not test the path requests take.
+//
+// The returned error is only non-nil if the checks could not be run at all.
+func (t *Target) TestConnectivity(ctx context.Context) (ConnectivityReport, error) {
+	u, err := url.Parse(t.baseURL)
+	if err != nil {
+		return ConnectivityReport{}, err
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	unauthenticated := *u
+	unauthenticated.User = nil
+	t.mu.RLock()
+	baseDoer := t.baseDoer // without authentication middleware
+	t.mu.RUnlock()
+	direct := dialsDirectly(baseDoer, u)
+
+	steps := []struct {
+		name           string
+		recommendation string
+		skip           bool
+		fn             func() error
+	}{
+		{
+			name:           "DNS resolution",
+			skip:           !direct,
+			recommendation: fmt.Sprintf("The host name %q cannot be resolved. Check its spelling and your DNS configuration, or use an IP address.", u.Hostname()),
+			fn: func() error {
+				_, err := net.DefaultResolver.LookupHost(ctx, u.Hostname())
+				return err
+			},
+		},
+
+		{
+			name:           "TCP connect",
+			skip:           !direct,
+			recommendation: fmt.Sprintf("The target does not accept connections on port %s. Check that it is powered on, in the same network and not blocked by a firewall.", port),
+			fn: func() error {
+				var d net.Dialer
+				conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+				if err != nil {
+					return err
+				}
+				return conn.Close()
+			},
+		},
+
+		{
+			name:           "HTTP without authentication",
+			recommendation: "The target accepts connections, but does not respond to HTTP requests. Check that the base URL points to the gokrazy web interface (scheme and port).",
+			fn: func() error {
+				_, err := connectivityGet(ctx, baseDoer, unauthenticated.String())
+				return err
+			},
+		},
+
+		{
+			name:           "HTTP with authentication",
+			recommendation: "The target rejects the credentials. Check the password (see gokr-pw.txt) and that special characters are escaped, or use WithBasicAuth.",
+			fn: func() error {
+				code, err := connectivityGet(ctx, t.httpDoer(), t.baseURL)
+				if err != nil {
+					return err
+				}
+				if code != http.StatusOK {
+					return fmt.Errorf("unexpected HTTP status code: got %d, want %d", code, http.StatusOK)
+				}
+				return nil
+			},
+		},
+
+		{
+			name:           "feature negotiation",
+			recommendation: "The target does not implement the update protocol. Check that the base URL ends in a slash and that the target runs gokrazy.",
+			fn: func() error {
+				return t.Ping(ctx)
+			},
+		},
+	}
+
+	var report ConnectivityReport
+	for _, step := range steps {
+		if report.Recommendation != "" || step.skip {
+			report.Steps = append(report.Steps, ConnectivityStep{
+				Name:   step.name,
+				Status: ConnectivitySkipped,
+			})
+			continue
+		}
+		if err := step.fn(); err != nil {
+			report.Steps = append(report.Steps, ConnectivityStep{
+				Name:   step.name,
+				Status: ConnectivityFailed,
+				Err:    err,
+			})
+			report.Recommendation = step.recommendation
+			continue
+		}
+		report.Steps = append(report.Steps, ConnectivityStep{
+			Name:   step.name,
+			Status: ConnectivityOK,
+		})
+	}
+	return report, nil
+}
+
+// dialsDirectly returns whether doer connects to the host of u via TCP without
+// a proxy, i.e. whether it uses the default transport (or an equivalent one).
+func dialsDirectly(doer HTTPDoer, u *url.URL) bool {
+	c, ok := doer.(*http.Client)
+	if !ok {
+		return false
+	}
+	rt := c.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	tr, ok := rt.(*http.Transport)
+	if !ok {
+		return false
+	}
+	if rt != http.DefaultTransport &&
+		(tr.DialContext != nil || tr.Dial != nil || tr.DialTLSContext != nil || tr.DialTLS != nil) {
+		return false
+	}
+	if tr.Proxy != nil {
+		proxyURL, err := tr.Proxy(&http.Request{URL: u})
+		if err != nil || proxyURL != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// connectivityGet issues a GET request for rawURL via doer and returns the HTTP
+// status code.
+func connectivityGet(ctx context.Context, doer HTTPDoer, rawURL string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := doer.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,48 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// supportBundleTimeout limits ExportSupportBundle when ctx has no deadline.
+const supportBundleTimeout = 10 * time.Minute
+
+// ExportSupportBundle writes a diagnostic archive (tar.gz) of the target to w,
+// containing logs, mount tables, process lists, kernel messages and the
+// partition layout.
+func (t *Target) ExportSupportBundle(ctx context.Context, w io.Writer) error {
+	if !t.Supports(ProtocolFeatureSupportBundle) {
+		return ErrUpdateHandlerNotImplemented
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, supportBundleTimeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", t.baseURL+"debug/support-bundle", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := t.httpDoer().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if got, want := resp.StatusCode, http.StatusOK; got != want {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected HTTP status code: got %d, want %d (body %q)", got, want, string(body))
+	}
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return err
+	}
+	t.logger.Info("exported support bundle",
+		"method", "ExportSupportBundle",
+		"bytes", n)
+	return nil
+}
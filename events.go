@@ -0,0 +1,109 @@
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	watchMinBackoff = 1 * time.Second
+	watchMaxBackoff = 30 * time.Second
+)
+
+// TargetEvent is a notification pushed by the target, see WatchEvents.
+type TargetEvent struct {
+	Type    string    `json:"type"`    // e.g. reboot or service-crash
+	Service string    `json:"service"` // e.g. /user/scan2drive, if applicable
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// errPermanent wraps errors which reconnecting cannot resolve.
+type errPermanent struct{ err error }
+
+func (e errPermanent) Error() string { return e.err.Error() }
+func (e errPermanent) Unwrap() error { return e.err }
+
+// WatchEvents receives events pushed by the target (e.g. spontaneous reboots
+// or service crashes) and sends them to out until ctx is done. Connection
+// errors are retried with exponential backoff.
+func (t *Target) WatchEvents(ctx context.Context, out chan<- TargetEvent) error {
+	backoff := watchMinBackoff
+	for {
+		received, err := t.watchEvents(ctx, out)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var perm errPermanent
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+		if received {
+			backoff = watchMinBackoff
+		}
+		t.logger.Warn("watching events, reconnecting",
+			"method", "WatchEvents",
+			"err", err,
+			"backoff", backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > watchMaxBackoff {
+			backoff = watchMaxBackoff
+		}
+	}
+}
+
+// watchEvents reads events from a single connection and reports whether any
+// events were received.
+func (t *Target) watchEvents(ctx context.Context, out chan<- TargetEvent) (received bool, _ error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", t.baseURL+"events", nil)
+	if err != nil {
+		return false, errPermanent{err}
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := t.httpDoer().Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, errPermanent{ErrUpdateHandlerNotImplemented}
+	}
+	if got, want := resp.StatusCode, http.StatusOK; got != want {
+		body, _ := ioutil.ReadAll(resp.Body)
+		err := fmt.Errorf("unexpected HTTP status code: got %d, want %d (body %q)", got, want, string(body))
+		if got < 500 {
+			err = errPermanent{err}
+		}
+		return false, err
+	}
+	err = readEvents(resp.Body, func(ev sseEvent) error {
+		var te TargetEvent
+		if err := json.Unmarshal([]byte(ev.Data), &te); err != nil {
+			return errPermanent{fmt.Errorf("parsing event: %v", err)}
+		}
+		if te.Type == "" {
+			te.Type = ev.Type
+		}
+		received = true
+		select {
+		case out <- te:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	if err == nil {
+		err = fmt.Errorf("connection closed by target")
+	}
+	return received, err
+}
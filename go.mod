@@ -1,3 +1,8 @@
 module github.com/gokrazy/updater
 
-go 1.15
+go 1.21
+
+require (
+	github.com/klauspost/compress v1.17.11
+	golang.org/x/oauth2 v0.24.0
+)
@@ -0,0 +1,218 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// pollInterval is the interval in which WaitForReboot checks the target.
+const pollInterval = 1 * time.Second
+
+// Ping checks that the target is reachable and responds to (authenticated)
+// HTTP requests.
+func (t *Target) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", t.baseURL+"update/features", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := t.httpDoer().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	// Targets which do not implement the /update/features handler yet reply
+	// with 404 Not Found, which still means they are up and running.
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("unexpected HTTP status code: got %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	return nil
+}
+
+// HealthStatus describes the health of the target device.
+type HealthStatus struct {
+	// OK is false if any supervised service is in a failed state.
+	OK bool
+
+	// Services maps service paths (e.g. /user/scan2drive) to their state
+	// (e.g. running, stopped or failed).
+	Services map[string]string
+
+	// Uptime is the time since the target device booted.
+	Uptime time.Duration
+}
+
+// HealthCheck returns the health of the target device, which (unlike Ping)
+// includes the state of all supervised services.
+func (t *Target) HealthCheck(ctx context.Context) (HealthStatus, error) {
+	if !t.Supports(ProtocolFeatureHealthEndpoint) {
+		return HealthStatus{}, ErrUpdateHandlerNotImplemented
+	}
+	var health struct {
+		Services      map[string]string `json:"services"`
+		UptimeSeconds float64           `json:"uptime_seconds"`
+	}
+	if err := t.doJSON(ctx, "GET", "health", nil, &health); err != nil {
+		return HealthStatus{}, err
+	}
+	status := HealthStatus{
+		OK:       true,
+		Services: health.Services,
+		Uptime:   time.Duration(health.UptimeSeconds * float64(time.Second)),
+	}
+	for _, state := range health.Services {
+		if state == "failed" {
+			status.OK = false
+		}
+	}
+	return status, nil
+}
+
+// WaitForReboot waits until the target (after a call to Reboot) went down and
+// came back up, and returns a new Target with freshly negotiated protocol
+// features, as the update might have changed them.
+//
+// The target is checked once per second, so reboots which take less than a
+// second go unnoticed and WaitForReboot keeps waiting until ctx is done.
+func (t *Target) WaitForReboot(ctx context.Context) (*Target, error) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	down := false
+	for {
+		err := t.Ping(ctx)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			down = true
+		} else if down {
+			t.mu.RLock()
+			baseDoer := t.baseDoer
+			t.mu.RUnlock()
+			return NewTarget(t.baseURL, baseDoer, t.opts...)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// TestbootWithTimeout marks the inactive root partition to be tested upon the
+// next boot (see Testboot), reboots the target and waits up to timeout for it to
+// come back up. If healthFn returns nil for the new Target, the partition is
+// confirmed and stays active. Otherwise, the device’s own boot counter reverts
+// to the previous partition.
+func (t *Target) TestbootWithTimeout(ctx context.Context, timeout time.Duration, healthFn func(*Target) error) error {
+	if err := t.Testboot(); err != nil {
+		return err
+	}
+	if err := t.Reboot(); err != nil {
+		return err
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	fresh, err := t.WaitForReboot(waitCtx)
+	if err != nil {
+		return fmt.Errorf("waiting for reboot: %w", err)
+	}
+	if err := healthFn(fresh); err != nil {
+		t.logger.Warn("test boot health check failed, not confirming (target will revert)",
+			"method", "TestbootWithTimeout",
+			"err", err)
+		return fmt.Errorf("health check: %w", err)
+	}
+	return fresh.doJSON(ctx, "POST", "update/testboot/confirm", nil, nil)
+}
+
+// A HealthCheckFn verifies an invariant of the target, e.g. that a specific
+// service is running, see WaitUntilHealthy.
+type HealthCheckFn func(ctx context.Context, t *Target) error
+
+// WaitUntilHealthy waits for the target to reboot (see WaitForReboot) and then
+// runs checks in order, retrying the full set until all checks pass or ctx is
+// done.
+func (t *Target) WaitUntilHealthy(ctx context.Context, checks ...HealthCheckFn) error {
+	fresh, err := t.WaitForReboot(ctx)
+	if err != nil {
+		return fmt.Errorf("waiting for reboot: %w", err)
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		err := runChecks(ctx, fresh, checks)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w (last check failure: %v)", ctx.Err(), err)
+		case <-ticker.C:
+		}
+	}
+}
+
+func runChecks(ctx context.Context, t *Target, checks []HealthCheckFn) error {
+	for _, check := range checks {
+		if err := check(ctx, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckServiceRunning returns a HealthCheckFn which verifies (using
+// HealthCheck) that the specified service (e.g. /user/scan2drive) is running.
+func CheckServiceRunning(name string) HealthCheckFn {
+	return func(ctx context.Context, t *Target) error {
+		status, err := t.HealthCheck(ctx)
+		if err != nil {
+			return err
+		}
+		state, ok := status.Services[name]
+		if !ok {
+			return fmt.Errorf("service %s not found", name)
+		}
+		if state != "running" {
+			return fmt.Errorf("service %s is %s, want running", name, state)
+		}
+		return nil
+	}
+}
+
+// CheckKernelVersion returns a HealthCheckFn which verifies that the target
+// runs the specified kernel version (as reported by uname -r, e.g.
+// 6.1.21-v8+).
+func CheckKernelVersion(v string) HealthCheckFn {
+	return func(ctx context.Context, t *Target) error {
+		info, err := t.GetSystemInfo(ctx)
+		if err != nil {
+			return err
+		}
+		if info.KernelVersion != v {
+			return fmt.Errorf("kernel version is %q, want %q", info.KernelVersion, v)
+		}
+		return nil
+	}
+}
+
+// CheckNoCrashes returns a HealthCheckFn which verifies (using GetCrashLogs)
+// that no supervised service crashed since the specified time.
+func CheckNoCrashes(since time.Time) HealthCheckFn {
+	return func(ctx context.Context, t *Target) error {
+		crashes, err := t.GetCrashLogs(ctx, since)
+		if err != nil {
+			return err
+		}
+		if len(crashes) > 0 {
+			c := crashes[0]
+			return fmt.Errorf("%d service crash(es) since %v, e.g. %s at %v: %s", len(crashes), since.Format(time.RFC3339), c.Service, c.CrashTime.Format(time.RFC3339), c.ExitCode)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,136 @@
+// Package testutil contains helpers for testing the updater package without
+// starting an HTTP server.
+package testutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Request is a request received by a MockDoer.
+type Request struct {
+	Method string
+	URL    *url.URL
+	Header http.Header
+	Body   []byte
+
+	// ContentLength is as set on the *http.Request, i.e. 0 if unknown.
+	ContentLength int64
+}
+
+type mockResponse struct {
+	method    string
+	urlSuffix string
+	resp      *http.Response
+	consumed  bool
+}
+
+// MockDoer is an updater.HTTPDoer which replies to requests with previously
+// added responses.
+type MockDoer struct {
+	mu        sync.Mutex
+	responses []*mockResponse
+	requests  []Request
+}
+
+// NewMockDoer returns a MockDoer without any responses.
+func NewMockDoer() *MockDoer {
+	return &MockDoer{}
+}
+
+// AddResponse makes the MockDoer reply with resp to the next request using
+// method whose URL ends in urlSuffix. Each response is used only once, in the
+// order in which they were added.
+func (m *MockDoer) AddResponse(method, urlSuffix string, resp *http.Response) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.responses = append(m.responses, &mockResponse{
+		method:    method,
+		urlSuffix: urlSuffix,
+		resp:      resp,
+	})
+}
+
+// Do implements updater.HTTPDoer. The request body is read completely before
+// the response is returned.
+func (m *MockDoer) Do(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, Request{
+		Method: req.Method,
+		URL:    req.URL,
+		Header: req.Header.Clone(),
+		Body:   body,
+
+		ContentLength: req.ContentLength,
+	})
+	u := req.URL.String()
+	for _, r := range m.responses {
+		if r.consumed ||
+			r.method != req.Method ||
+			!strings.HasSuffix(u, r.urlSuffix) {
+			continue
+		}
+		r.consumed = true
+		r.resp.Request = req
+		return r.resp, nil
+	}
+	return nil, fmt.Errorf("testutil.MockDoer: no response for %s %s", req.Method, u)
+}
+
+// Requests returns all requests received so far.
+func (m *MockDoer) Requests() []Request {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Request(nil), m.requests...)
+}
+
+// AssertConsumed fails the test if any of the added responses were not used.
+func (m *MockDoer) AssertConsumed(t testing.TB) {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.responses {
+		if !r.consumed {
+			t.Errorf("response for %s …%s not consumed", r.method, r.urlSuffix)
+		}
+	}
+}
+
+// NewResponse returns an *http.Response with the specified status code,
+// Content-Type header (if non-empty) and body.
+func NewResponse(code int, contentType, body string) *http.Response {
+	resp := &http.Response{
+		Status:        strconv.Itoa(code) + " " + http.StatusText(code),
+		StatusCode:    code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+	if contentType != "" {
+		resp.Header.Set("Content-Type", contentType)
+	}
+	return resp
+}
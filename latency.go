@@ -0,0 +1,78 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// LatencyStats summarizes round-trip times to the target.
+type LatencyStats struct {
+	Min, Max, Mean, P99 time.Duration
+
+	// Jitter is the mean difference between consecutive samples.
+	Jitter time.Duration
+}
+
+// MeasureLatency sends samples HEAD requests to the target and returns
+// statistics about their round-trip times, e.g. to decide whether to use
+// compression or chunked uploads. An unmeasured request is sent first (see
+// PrewarmConnection), so that connection setup does not skew the statistics.
+func (t *Target) MeasureLatency(ctx context.Context, samples int) (LatencyStats, error) {
+	if samples < 1 {
+		return LatencyStats{}, fmt.Errorf("invalid number of samples %d", samples)
+	}
+	if err := t.PrewarmConnection(ctx); err != nil {
+		return LatencyStats{}, err
+	}
+	rtts := make([]time.Duration, 0, samples)
+	for i := 0; i < samples; i++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, t.baseURL+"update/features", nil)
+		if err != nil {
+			return LatencyStats{}, err
+		}
+		start := time.Now()
+		resp, err := t.httpDoer().Do(req)
+		if err != nil {
+			return LatencyStats{}, err
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		rtts = append(rtts, time.Since(start))
+	}
+	return latencyStats(rtts), nil
+}
+
+// latencyStats computes LatencyStats of the (non-empty) samples, in the order
+// in which they were taken.
+func latencyStats(samples []time.Duration) LatencyStats {
+	var stats LatencyStats
+	var sum, jitterSum time.Duration
+	for i, s := range samples {
+		sum += s
+		if i > 0 {
+			diff := s - samples[i-1]
+			if diff < 0 {
+				diff = -diff
+			}
+			jitterSum += diff
+		}
+	}
+	stats.Mean = sum / time.Duration(len(samples))
+	if len(samples) > 1 {
+		stats.Jitter = jitterSum / time.Duration(len(samples)-1)
+	}
+
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	stats.Min = sorted[0]
+	stats.Max = sorted[len(sorted)-1]
+	// nearest-rank method
+	rank := (99*len(sorted) + 99) / 100
+	stats.P99 = sorted[rank-1]
+	return stats
+}
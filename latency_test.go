@@ -0,0 +1,60 @@
+package updater
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLatencyStats(t *testing.T) {
+	ms := time.Millisecond
+	got := latencyStats([]time.Duration{10 * ms, 30 * ms, 20 * ms, 40 * ms})
+	want := LatencyStats{
+		Min:    10 * ms,
+		Max:    40 * ms,
+		Mean:   25 * ms,
+		P99:    40 * ms,
+		Jitter: 50 * ms / 3, // (20+10+20)/3
+	}
+	if got != want {
+		t.Errorf("latencyStats() = %+v, want %+v", got, want)
+	}
+}
+
+// slowFirstDoer simulates connection setup by delaying its first response.
+type slowFirstDoer struct {
+	requests int
+}
+
+func (d *slowFirstDoer) Do(req *http.Request) (*http.Response, error) {
+	d.requests++
+	if d.requests == 1 {
+		time.Sleep(100 * time.Millisecond)
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader(`{}`)),
+	}, nil
+}
+
+func TestMeasureLatencyWarmup(t *testing.T) {
+	doer := &slowFirstDoer{}
+	target, err := NewTarget("http://gokrazy/", doer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doer.requests = 0 // a fresh connection for MeasureLatency
+	stats, err := target.MeasureLatency(context.Background(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := doer.requests, 4; got != want {
+		t.Errorf("MeasureLatency sent %d requests, want %d", got, want)
+	}
+	if stats.Max >= 100*time.Millisecond {
+		t.Errorf("MeasureLatency() Max = %v, includes the warm-up request", stats.Max)
+	}
+}
@@ -0,0 +1,76 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const updateLockHeader = "X-Gokrazy-Update-Lock"
+
+// ErrUpdateLockHeld is returned by AcquireUpdateLock when another client
+// currently holds the update lock.
+var ErrUpdateLockHeld = errors.New("update lock held by another client")
+
+// A LockToken identifies an update lock acquired via AcquireUpdateLock.
+type LockToken string
+
+// QueryUpdateLock returns whether any client currently holds the update lock
+// of the target.
+func (t *Target) QueryUpdateLock(ctx context.Context) (bool, error) {
+	var lock struct {
+		Locked bool `json:"locked"`
+	}
+	if err := t.doJSON(ctx, "GET", "update/lock", nil, &lock); err != nil {
+		return false, err
+	}
+	return lock.Locked, nil
+}
+
+// AcquireUpdateLock acquires the update lock of the target on behalf of owner
+// (e.g. "ci-bot"), which is shown to other clients. The lock expires after ttl
+// unless released earlier using ReleaseUpdateLock.
+//
+// While the lock is held, StreamTo sends the token along with each update, so
+// that the target rejects updates from other clients.
+func (t *Target) AcquireUpdateLock(ctx context.Context, owner string, ttl time.Duration) (LockToken, error) {
+	var lock struct {
+		Token LockToken `json:"token"`
+	}
+	err := t.doJSON(ctx, "POST", "update/lock", struct {
+		Owner      string `json:"owner"`
+		TTLSeconds int64  `json:"ttl_seconds"`
+	}{
+		Owner:      owner,
+		TTLSeconds: int64(ttl.Seconds()),
+	}, &lock)
+	if err != nil {
+		var se *statusError
+		if errors.As(err, &se) && se.code == http.StatusConflict {
+			return "", ErrUpdateLockHeld
+		}
+		return "", err
+	}
+	t.mu.Lock()
+	t.lockToken = lock.Token
+	t.mu.Unlock()
+	return lock.Token, nil
+}
+
+// ReleaseUpdateLock releases the update lock identified by token.
+func (t *Target) ReleaseUpdateLock(ctx context.Context, token LockToken) error {
+	if err := t.doJSON(ctx, "DELETE", "update/lock", struct {
+		Token LockToken `json:"token"`
+	}{
+		Token: token,
+	}, nil); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	if t.lockToken == token {
+		t.lockToken = ""
+	}
+	t.mu.Unlock()
+	return nil
+}
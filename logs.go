@@ -0,0 +1,62 @@
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// LogLine is a line of output of a supervised service, as streamed by TailLogs.
+type LogLine struct {
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"` // stdout or stderr
+	Line   string    `json:"line"`
+}
+
+// TailLogs streams the output of the specified service (e.g.
+// /user/scan2drive), starting with the most recent lines, to out. TailLogs
+// returns when ctx is done, when the target closes the connection (nil is
+// returned) or when an event cannot be parsed.
+func (t *Target) TailLogs(ctx context.Context, service string, lines int, out chan<- LogLine) error {
+	v := url.Values{}
+	v.Set("service", service)
+	v.Set("lines", strconv.Itoa(lines))
+	req, err := http.NewRequestWithContext(ctx, "GET", t.baseURL+"log/stream?"+v.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := t.httpDoer().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrUpdateHandlerNotImplemented
+	}
+	if got, want := resp.StatusCode, http.StatusOK; got != want {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected HTTP status code: got %d, want %d (body %q)", got, want, string(body))
+	}
+	err = readEvents(resp.Body, func(ev sseEvent) error {
+		var l LogLine
+		if err := json.Unmarshal([]byte(ev.Data), &l); err != nil {
+			return fmt.Errorf("parsing log event: %v", err)
+		}
+		select {
+		case out <- l:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
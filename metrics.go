@@ -0,0 +1,103 @@
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// targetMetrics are accumulated over the lifetime of a Target.
+type targetMetrics struct {
+	bytesTransferred atomic.Int64
+	updates          atomic.Int64
+	lastDuration     atomic.Int64 // nanoseconds
+	lastUpdate       atomic.Int64 // unix nanoseconds
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n.Add(int64(n))
+	return n, err
+}
+
+// Close closes r if it is an io.Closer, so that wrapping a request body does
+// not prevent the HTTP client from closing it.
+func (cr *countingReader) Close() error {
+	if c, ok := cr.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// recordUpdate records a successful update which started at start. It is
+// called once per update, not per request, so that chunked and resumed updates
+// are counted once.
+func (m *targetMetrics) recordUpdate(start time.Time) {
+	now := time.Now()
+	m.updates.Add(1)
+	m.lastDuration.Store(int64(now.Sub(start)))
+	m.lastUpdate.Store(now.UnixNano())
+}
+
+// PublishMetrics writes the metrics accumulated over the lifetime of the Target
+// to w, in the specified format: "prometheus" (text exposition format) or
+// "json".
+func (t *Target) PublishMetrics(ctx context.Context, w io.Writer, format string) error {
+	host := t.baseURL
+	if u, err := url.Parse(t.baseURL); err == nil {
+		host = u.Host
+	}
+	bytes := t.metrics.bytesTransferred.Load()
+	updates := t.metrics.updates.Load()
+	duration := time.Duration(t.metrics.lastDuration.Load()).Seconds()
+	var last float64
+	if ns := t.metrics.lastUpdate.Load(); ns != 0 {
+		last = float64(ns) / float64(time.Second)
+	}
+
+	switch format {
+	case "prometheus":
+		for _, m := range []struct {
+			name, typ, help string
+			value           float64
+		}{
+			{"updater_bytes_transferred_total", "counter", "Bytes sent in update requests.", float64(bytes)},
+			{"updater_updates_total", "counter", "Successful updates (e.g. StreamTo calls).", float64(updates)},
+			{"updater_update_duration_seconds", "gauge", "Duration of the most recent successful update.", duration},
+			{"updater_last_update_timestamp", "gauge", "Unix time of the most recent successful update.", last},
+		} {
+			if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s{target=%q} %g\n", m.name, m.help, m.name, m.typ, m.name, host, m.value); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "json":
+		return json.NewEncoder(w).Encode(struct {
+			Target                string  `json:"target"`
+			BytesTransferredTotal int64   `json:"updater_bytes_transferred_total"`
+			UpdatesTotal          int64   `json:"updater_updates_total"`
+			UpdateDurationSeconds float64 `json:"updater_update_duration_seconds"`
+			LastUpdateTimestamp   float64 `json:"updater_last_update_timestamp"`
+		}{
+			Target:                host,
+			BytesTransferredTotal: bytes,
+			UpdatesTotal:          updates,
+			UpdateDurationSeconds: duration,
+			LastUpdateTimestamp:   last,
+		})
+
+	default:
+		return fmt.Errorf("unknown metrics format %q, want prometheus or json", format)
+	}
+}
@@ -0,0 +1,97 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// WifiPSKWarning is returned by ConfigureWifi when the Wi-Fi configuration was
+// applied successfully, but the pre-shared key was sent over unencrypted HTTP.
+type WifiPSKWarning struct{}
+
+func (*WifiPSKWarning) Error() string {
+	return "Wi-Fi pre-shared key was sent over unencrypted HTTP"
+}
+
+// ConfigureWifi configures the target to connect to the Wi-Fi network ssid
+// using the pre-shared key psk, without re-flashing the boot partition.
+//
+// If the target is accessed via plain HTTP, the configuration is applied, but
+// a *WifiPSKWarning is returned, which callers can choose to ignore.
+func (t *Target) ConfigureWifi(ctx context.Context, ssid, psk string) error {
+	if !t.Supports(ProtocolFeatureWifiConfig) {
+		return ErrUpdateHandlerNotImplemented
+	}
+	if err := t.doJSON(ctx, "POST", "config/wifi", struct {
+		SSID string `json:"ssid"`
+		PSK  string `json:"psk"`
+	}{
+		SSID: ssid,
+		PSK:  psk,
+	}, nil); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(t.baseURL, "https://") {
+		return &WifiPSKWarning{}
+	}
+	return nil
+}
+
+// DNSConfig is the resolver configuration of the target device.
+type DNSConfig struct {
+	Servers       []net.IP `json:"servers"`        // IPv4 or IPv6
+	SearchDomains []string `json:"search_domains"` // e.g. lan
+}
+
+// SetDNS reconfigures the resolver of the target device to use the specified
+// DNS servers (IPv4 or IPv6) and search domains, without a reboot.
+func (t *Target) SetDNS(ctx context.Context, servers []net.IP, searchDomains []string) error {
+	if !t.Supports(ProtocolFeatureDNSConfig) {
+		return ErrUpdateHandlerNotImplemented
+	}
+	for _, ip := range servers {
+		if ip.To16() == nil {
+			return fmt.Errorf("invalid DNS server IP address %v", ip)
+		}
+	}
+	return t.doJSON(ctx, "POST", "network/dns", DNSConfig{
+		Servers:       servers,
+		SearchDomains: searchDomains,
+	}, nil)
+}
+
+// GetDNS returns the effective resolver configuration of the target device.
+func (t *Target) GetDNS(ctx context.Context) (DNSConfig, error) {
+	if !t.Supports(ProtocolFeatureDNSConfig) {
+		return DNSConfig{}, ErrUpdateHandlerNotImplemented
+	}
+	var cfg DNSConfig
+	if err := t.doJSON(ctx, "GET", "network/dns", nil, &cfg); err != nil {
+		return DNSConfig{}, err
+	}
+	return cfg, nil
+}
+
+// NetworkStats are the counters of the target device’s network interface.
+type NetworkStats struct {
+	Interface string `json:"interface"` // e.g. eth0
+	RxBytes   uint64 `json:"rx_bytes"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	RxErrors  uint64 `json:"rx_errors"`
+	TxErrors  uint64 `json:"tx_errors"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxDropped uint64 `json:"tx_dropped"`
+}
+
+// GetNetworkStats returns the counters of the network interface through which
+// the target device is reached. Comparing the counters before and after
+// StreamTo quantifies errors and packet loss during the update.
+func (t *Target) GetNetworkStats(ctx context.Context) (NetworkStats, error) {
+	var stats NetworkStats
+	if err := t.doJSON(ctx, "GET", "network/stats", nil, &stats); err != nil {
+		return NetworkStats{}, err
+	}
+	return stats, nil
+}
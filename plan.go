@@ -0,0 +1,166 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// UpdatePlan describes the images to write to the target in an update.
+type UpdatePlan struct {
+	// Root, Boot and MBR are streamed to the respective destination (see
+	// StreamTo), if non-nil. The MBR is only relevant on PCs.
+	Root, Boot, MBR io.Reader
+
+	// RootByArch and BootByArch, if non-nil, map architectures (GOARCH, e.g.
+	// arm64 or amd64) to images. The image for the target’s architecture (see
+	// GetSystemInfo) is used instead of Root and Boot, respectively.
+	RootByArch, BootByArch map[string]io.Reader
+
+	// MaxTempCelsius, if non-zero, makes ExecutePlan verify (see
+	// CheckThermalSafe) that the target is not too hot before writing.
+	MaxTempCelsius float64
+}
+
+// ExecutePlan writes the images of plan to the target and switches to the
+// updated root partition. The target needs to be rebooted afterwards.
+//
+// Plans without a root image do not switch: the boot image is written to the
+// bootonly destination (see StreamTo) so that the running root partition stays
+// active.
+func (t *Target) ExecutePlan(ctx context.Context, plan UpdatePlan) error {
+	if plan.Root == nil && plan.RootByArch == nil &&
+		plan.Boot == nil && plan.BootByArch == nil &&
+		plan.MBR == nil {
+		return fmt.Errorf("update plan contains no images")
+	}
+	if err := t.preflight(ctx, plan); err != nil {
+		return fmt.Errorf("pre-flight check: %w", err)
+	}
+
+	if plan.RootByArch != nil || plan.BootByArch != nil {
+		info, err := t.GetSystemInfo(ctx)
+		if err != nil {
+			return fmt.Errorf("determining architecture: %w", err)
+		}
+		if plan.RootByArch != nil {
+			r, ok := plan.RootByArch[info.Arch]
+			if !ok {
+				return fmt.Errorf("no root image for architecture %q", info.Arch)
+			}
+			plan.Root = r
+		}
+		if plan.BootByArch != nil {
+			r, ok := plan.BootByArch[info.Arch]
+			if !ok {
+				return fmt.Errorf("no boot image for architecture %q", info.Arch)
+			}
+			plan.Boot = r
+		}
+	}
+
+	bootDest := "boot"
+	if plan.Root == nil {
+		bootDest = "bootonly"
+	}
+	// Start with the root file system because writing to the non-active
+	// partition cannot break the currently running system.
+	for _, p := range []struct {
+		dest string
+		r    io.Reader
+	}{
+		{"root", plan.Root},
+		{bootDest, plan.Boot},
+		{"mbr", plan.MBR},
+	} {
+		if p.r == nil {
+			continue
+		}
+		if err := t.streamTo(ctx, p.dest, p.r, -1); err != nil {
+			return fmt.Errorf("updating %s: %w", p.dest, err)
+		}
+	}
+
+	if plan.Root == nil {
+		return nil // the inactive root partition was not updated
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := t.Switch(); err != nil {
+		return fmt.Errorf("switching to non-active partition: %w", err)
+	}
+	return nil
+}
+
+// preflight verifies that the target is in a state in which plan can be
+// executed safely.
+func (t *Target) preflight(ctx context.Context, plan UpdatePlan) error {
+	if plan.MaxTempCelsius != 0 {
+		if err := t.CheckThermalSafe(ctx, plan.MaxTempCelsius); err != nil {
+			return err
+		}
+	}
+	if t.Supports(ProtocolFeatureStorageHealth) {
+		// Worn storage is not a reason to skip the update, but worth
+		// surfacing to the operator.
+		health, err := t.GetStorageHealth(ctx)
+		if err != nil && err != ErrUpdateHandlerNotImplemented {
+			t.logger.Warn("could not get storage health",
+				"method", "ExecutePlan",
+				"err", err)
+		}
+		if err == nil && health.EnduranceUsedPercent > storageWearWarnPercent {
+			t.logger.Warn("storage is worn, consider replacing it",
+				"method", "ExecutePlan",
+				"device", health.Device,
+				"endurance_used_percent", health.EnduranceUsedPercent)
+		}
+	}
+	return nil
+}
+
+// storageWearWarnPercent is the EnduranceUsedPercent above which ExecutePlan
+// logs a warning.
+const storageWearWarnPercent = 80
+
+// UpdateAndVerify executes plan (see ExecutePlan), reboots the target, waits
+// for it to come back (see WaitForReboot) and calls verifyFn with the new
+// Target. If verification fails, the previous root partition is made active
+// again and the target is rebooted.
+//
+// Only the root partition can be rolled back: if plan contains a boot image or
+// an MBR, the previous root partition would be booted with the new kernel,
+// whose modules it lacks. In that case (and for plans without a root image),
+// UpdateAndVerify does not roll back and returns the verification error.
+func (t *Target) UpdateAndVerify(ctx context.Context, plan UpdatePlan, verifyFn func(*Target) error) error {
+	if err := t.ExecutePlan(ctx, plan); err != nil {
+		return err
+	}
+	if err := t.Reboot(); err != nil {
+		return fmt.Errorf("reboot: %w", err)
+	}
+	fresh, err := t.WaitForReboot(ctx)
+	if err != nil {
+		return fmt.Errorf("waiting for reboot: %w", err)
+	}
+	verifyErr := verifyFn(fresh)
+	if verifyErr == nil {
+		return nil
+	}
+	verifyErr = fmt.Errorf("verification: %w", verifyErr)
+	if plan.Boot != nil || plan.BootByArch != nil || plan.MBR != nil ||
+		(plan.Root == nil && plan.RootByArch == nil) {
+		return errors.Join(verifyErr, fmt.Errorf("not rolling back: only updates of the root partition alone can be rolled back"))
+	}
+	// After the reboot, the partition which was running before the update is
+	// the inactive one, so Switch activates it.
+	if err := fresh.Switch(); err != nil {
+		return errors.Join(verifyErr, fmt.Errorf("rolling back: switch: %w", err))
+	}
+	if err := fresh.Reboot(); err != nil {
+		return errors.Join(verifyErr, fmt.Errorf("rolling back: reboot: %w", err))
+	}
+	return verifyErr
+}
@@ -0,0 +1,124 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+)
+
+type report struct {
+	Generated       time.Time         `json:"generated"`
+	Target          string            `json:"target"`
+	Features        []string          `json:"features"`
+	ActivePartition string            `json:"active_partition,omitempty"`
+	EEPROM          EEPROMVersion     `json:"eeprom"`
+	Services        map[string]string `json:"services,omitempty"`
+	Annotations     []Annotation      `json:"annotations,omitempty"`
+	Transfer        reportTransfer    `json:"transfer"`
+}
+
+// reportTransfer contains the metrics of the updates made via the Target (see
+// PublishMetrics).
+type reportTransfer struct {
+	Updates                   int64      `json:"updates"`
+	BytesTransferred          int64      `json:"bytes_transferred"`
+	LastUpdate                *time.Time `json:"last_update,omitempty"`
+	LastUpdateDurationSeconds float64    `json:"last_update_duration_seconds,omitempty"`
+}
+
+// reportAnnotations is the number of most recent annotations included in
+// reports.
+const reportAnnotations = 10
+
+// GenerateReport returns a summary of the target’s state (active partition,
+// EEPROM version, service states and recent annotations) and of the updates
+// made via this Target (count, bytes transferred, time and duration of the
+// most recent one) in the specified format: "json", or "markdown", which is
+// suitable for a GitHub Actions step summary. Information which the target
+// does not provide is omitted. Partition hashes are not included, as the
+// target does not report them.
+func (t *Target) GenerateReport(ctx context.Context, format string) ([]byte, error) {
+	if format != "json" && format != "markdown" {
+		return nil, fmt.Errorf("unknown report format %q, want json or markdown", format)
+	}
+	rep := report{
+		Generated: time.Now(),
+		Target:    redactedBaseURL(t.baseURL),
+		Features:  t.supports,
+		EEPROM:    t.InstalledEEPROM(),
+	}
+	rep.Transfer = reportTransfer{
+		Updates:                   t.metrics.updates.Load(),
+		BytesTransferred:          t.metrics.bytesTransferred.Load(),
+		LastUpdateDurationSeconds: time.Duration(t.metrics.lastDuration.Load()).Seconds(),
+	}
+	if ns := t.metrics.lastUpdate.Load(); ns != 0 {
+		last := time.Unix(0, ns)
+		rep.Transfer.LastUpdate = &last
+	}
+	var err error
+	rep.ActivePartition, err = t.GetActivePartition(ctx)
+	if err != nil && err != ErrUpdateHandlerNotImplemented {
+		return nil, err
+	}
+	health, err := t.HealthCheck(ctx)
+	if err != nil && err != ErrUpdateHandlerNotImplemented {
+		return nil, err
+	}
+	rep.Services = health.Services
+	rep.Annotations, err = t.GetAnnotations(ctx, reportAnnotations)
+	if err != nil && err != ErrUpdateHandlerNotImplemented {
+		return nil, err
+	}
+
+	if format == "json" {
+		return json.MarshalIndent(rep, "", "  ")
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "## gokrazy update report: %s\n\n", rep.Target)
+	fmt.Fprintf(&buf, "Generated %s\n\n", rep.Generated.Format(time.RFC3339))
+	fmt.Fprintf(&buf, "| | |\n|---|---|\n")
+	if rep.ActivePartition != "" {
+		fmt.Fprintf(&buf, "| Active partition | `%s` |\n", rep.ActivePartition)
+	}
+	fmt.Fprintf(&buf, "| pieeprom.sig | `%s` |\n", rep.EEPROM.PieepromSHA256)
+	fmt.Fprintf(&buf, "| vl805.sig | `%s` |\n", rep.EEPROM.VL805SHA256)
+	fmt.Fprintf(&buf, "| Updates | %d |\n", rep.Transfer.Updates)
+	fmt.Fprintf(&buf, "| Bytes transferred | %d |\n", rep.Transfer.BytesTransferred)
+	if last := rep.Transfer.LastUpdate; last != nil {
+		duration := time.Duration(rep.Transfer.LastUpdateDurationSeconds * float64(time.Second))
+		fmt.Fprintf(&buf, "| Last update | %s (took %s) |\n", last.Format(time.RFC3339), duration.Round(time.Millisecond))
+	}
+	if len(rep.Services) > 0 {
+		services := make([]string, 0, len(rep.Services))
+		for name := range rep.Services {
+			services = append(services, name)
+		}
+		sort.Strings(services)
+		fmt.Fprintf(&buf, "\n### Services\n\n| Service | State |\n|---|---|\n")
+		for _, name := range services {
+			fmt.Fprintf(&buf, "| `%s` | %s |\n", name, rep.Services[name])
+		}
+	}
+	if len(rep.Annotations) > 0 {
+		fmt.Fprintf(&buf, "\n### Annotations\n\n")
+		for _, a := range rep.Annotations {
+			fmt.Fprintf(&buf, "- %s: %s\n", a.Time.Format(time.RFC3339), a.Text)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// redactedBaseURL returns baseURL with the password (if any) replaced by
+// “xxxxx”, so that it can be included in reports and logs.
+func redactedBaseURL(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "<unparseable URL>"
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,229 @@
+package updater
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// resumeCheckpointInterval is the number of bytes after which StreamTo saves
+// its progress to the ResumeState.
+const resumeCheckpointInterval = 64 * 1024 * 1024
+
+// ResumeState persists the progress of updates so that an interrupted update
+// can be continued, even by a different process.
+//
+// partialHash is an opaque serialization of the update hash state covering the
+// first offset bytes. Saving an offset of 0 clears the state for dest.
+type ResumeState interface {
+	Save(dest string, offset int64, partialHash []byte) error
+	Load(dest string) (offset int64, partialHash []byte, ok bool)
+}
+
+// WithResumeStore makes StreamTo save its progress to store and continue
+// interrupted updates, if the target supports ProtocolFeatureResume. If the
+// target rejects continuing an update, the saved progress is discarded and
+// StreamTo starts from scratch (provided the reader implements io.Seeker).
+func WithResumeStore(store ResumeState) TargetOption {
+	return func(t *Target) {
+		t.resume = store
+	}
+}
+
+// FileResumeStore is a ResumeState which stores one JSON file per update
+// destination in a directory.
+type FileResumeStore struct {
+	Dir string
+}
+
+type resumeFile struct {
+	Offset      int64  `json:"offset"`
+	PartialHash []byte `json:"partial_hash"`
+}
+
+func (s *FileResumeStore) path(dest string) string {
+	return filepath.Join(s.Dir, "resume-"+dest+".json")
+}
+
+// Save implements ResumeState.
+func (s *FileResumeStore) Save(dest string, offset int64, partialHash []byte) error {
+	if offset == 0 {
+		if err := os.Remove(s.path(dest)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	b, err := json.Marshal(resumeFile{
+		Offset:      offset,
+		PartialHash: partialHash,
+	})
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file and rename it so that a crash never leaves a
+	// truncated state file behind.
+	tmp := s.path(dest) + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(dest))
+}
+
+// Load implements ResumeState.
+func (s *FileResumeStore) Load(dest string) (int64, []byte, bool) {
+	b, err := ioutil.ReadFile(s.path(dest))
+	if err != nil {
+		return 0, nil, false
+	}
+	var f resumeFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return 0, nil, false
+	}
+	return f.Offset, f.PartialHash, true
+}
+
+// updateOffsetHeader is the response header in which the target reports how
+// many bytes of an interrupted update it has committed.
+const updateOffsetHeader = "X-Gokrazy-Update-Offset"
+
+// checkpointReader hashes everything read from r and periodically saves the
+// offset and hash state to a ResumeState.
+type checkpointReader struct {
+	r      io.Reader
+	hash   io.Writer
+	save   func(offset int64) error
+	offset int64
+	saved  int64
+}
+
+func (cr *checkpointReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.hash.Write(p[:n])
+	cr.offset += int64(n)
+	// Saved offsets are usually ahead of what the target actually received
+	// when the connection drops, which is why streamToResumable asks the
+	// target for its committed offset before resuming.
+	if cr.offset-cr.saved >= resumeCheckpointInterval {
+		if err := cr.save(cr.offset); err != nil {
+			return n, fmt.Errorf("saving resume state: %v", err)
+		}
+		cr.saved = cr.offset
+	}
+	return n, err
+}
+
+// resumeOffset returns the offset from which the update of dest can be
+// continued: the lower of saved and the offset the target reports to have
+// committed, or 0 if the target does not report one.
+func (t *Target) resumeOffset(ctx context.Context, dest string, saved int64) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, t.baseURL+"update/"+dest, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := t.httpDoer().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, nil
+	}
+	committed, err := strconv.ParseInt(resp.Header.Get(updateOffsetHeader), 10, 64)
+	if err != nil || committed < 0 {
+		return 0, nil
+	}
+	if committed < saved {
+		return committed, nil
+	}
+	return saved, nil
+}
+
+func (t *Target) streamToResumable(ctx context.Context, dest string, r io.Reader) error {
+	hash := t.newUpdateHash()
+	marshaler, ok := hash.(encoding.BinaryMarshaler)
+	if !ok {
+		return fmt.Errorf("BUG: %T does not implement encoding.BinaryMarshaler", hash)
+	}
+
+	method := http.MethodPut
+	var offset int64
+	if saved, state, ok := t.resume.Load(dest); ok && saved > 0 {
+		off, err := t.resumeOffset(ctx, dest, saved)
+		if err != nil {
+			return err
+		}
+		if off > 0 {
+			// The saved hash state only covers the saved offset, and it
+			// might have been created with a different hash (e.g. before
+			// the target gained ProtocolFeatureUpdateHash). In both cases,
+			// the skipped bytes are hashed instead.
+			var skipped io.Writer = ioutil.Discard
+			if off != saved || hash.(encoding.BinaryUnmarshaler).UnmarshalBinary(state) != nil {
+				hash.Reset()
+				skipped = hash
+			}
+			if _, err := io.CopyN(skipped, r, off); err != nil {
+				return fmt.Errorf("skipping to resume offset %d: %v", off, err)
+			}
+			method = http.MethodPatch
+			offset = off
+		}
+	}
+
+	cr := &checkpointReader{
+		r:      r,
+		hash:   hash,
+		offset: offset,
+		saved:  offset,
+		save: func(offset int64) error {
+			state, err := marshaler.MarshalBinary()
+			if err != nil {
+				return err
+			}
+			return t.resume.Save(dest, offset, state)
+		},
+	}
+	req, err := t.newUpdateRequest(ctx, method, dest, cr, -1)
+	if err != nil {
+		return err
+	}
+	if method == http.MethodPatch {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-*/*", offset))
+	}
+	err = t.doUpdate(req, hash.Sum)
+	if err == nil {
+		return t.resume.Save(dest, 0, nil)
+	}
+	var se *statusError
+	rejected := method == http.MethodPatch && errors.As(err, &se)
+	if rejected || errors.Is(err, ErrHashMismatch) {
+		// Continuing from the saved state cannot succeed.
+		if err := t.resume.Save(dest, 0, nil); err != nil {
+			return err
+		}
+	}
+	if !rejected {
+		return err
+	}
+	t.logger.Warn("target rejected resuming the update, starting from scratch",
+		"method", "StreamTo",
+		"dest", dest,
+		"offset", offset,
+		"err", err)
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		return fmt.Errorf("resuming update at offset %d: %w (cannot rewind, retry to start from scratch)", offset, err)
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return t.streamToResumable(ctx, dest, r)
+}
@@ -0,0 +1,167 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// serviceURLPath returns the URL path for the specified service (e.g.
+// /user/scan2drive) and handler.
+func serviceURLPath(service, handler string) string {
+	return "service/" + strings.TrimPrefix(service, "/") + "/" + handler
+}
+
+// Freeze pauses the specified service (e.g. /user/scan2drive) by sending it
+// SIGSTOP. The process is not killed and continues where it left off once
+// Thaw is called.
+func (t *Target) Freeze(ctx context.Context, service string) error {
+	if !t.Supports(ProtocolFeatureFreeze) {
+		return ErrUpdateHandlerNotImplemented
+	}
+	return t.doJSON(ctx, "POST", serviceURLPath(service, "freeze"), nil, nil)
+}
+
+// Thaw resumes a service previously paused using Freeze by sending it SIGCONT.
+func (t *Target) Thaw(ctx context.Context, service string) error {
+	if !t.Supports(ProtocolFeatureFreeze) {
+		return ErrUpdateHandlerNotImplemented
+	}
+	return t.doJSON(ctx, "POST", serviceURLPath(service, "thaw"), nil, nil)
+}
+
+// ContainerInfo describes an OCI container running on the target device.
+type ContainerInfo struct {
+	ID        string    `json:"id"`
+	Image     string    `json:"image"`  // e.g. docker.io/library/nginx:1.25
+	Status    string    `json:"status"` // e.g. running or exited
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GetContainerStatus returns the OCI containers of the target device.
+func (t *Target) GetContainerStatus(ctx context.Context) ([]ContainerInfo, error) {
+	if !t.Supports(ProtocolFeatureContainers) {
+		return nil, ErrUpdateHandlerNotImplemented
+	}
+	var containers []ContainerInfo
+	if err := t.doJSON(ctx, "GET", "containers", nil, &containers); err != nil {
+		return nil, err
+	}
+	return containers, nil
+}
+
+// SetFlag overrides the command line flag flagName of the specified service
+// (e.g. /user/scan2drive) with flagValue and restarts the service.
+func (t *Target) SetFlag(ctx context.Context, servicePath, flagName, flagValue string) error {
+	if !t.Supports(ProtocolFeatureRuntimeFlags) {
+		return ErrUpdateHandlerNotImplemented
+	}
+	return t.doJSON(ctx, "POST", serviceURLPath(servicePath, "flags"), struct {
+		Flag  string `json:"flag"`
+		Value string `json:"value"`
+	}{
+		Flag:  flagName,
+		Value: flagValue,
+	}, nil)
+}
+
+// GetFlags returns the command line flags of the specified service, including
+// overrides set via SetFlag, keyed by flag name.
+func (t *Target) GetFlags(ctx context.Context, servicePath string) (map[string]string, error) {
+	if !t.Supports(ProtocolFeatureRuntimeFlags) {
+		return nil, ErrUpdateHandlerNotImplemented
+	}
+	var flags map[string]string
+	if err := t.doJSON(ctx, "GET", serviceURLPath(servicePath, "flags"), nil, &flags); err != nil {
+		return nil, err
+	}
+	return flags, nil
+}
+
+// debugShellMaxOutput is the maximum number of bytes of output DebugShell
+// requests from the target.
+const debugShellMaxOutput = 1 << 20
+
+// ErrDebugOutputTruncated is returned by DebugShell (along with the output)
+// when the command produced more output than DebugShell returns.
+var ErrDebugOutputTruncated = errors.New("debug command output truncated")
+
+// DebugShell runs cmd in the namespace of the specified service (e.g.
+// /user/scan2drive) and returns its standard output. At most 1 MiB of output
+// is returned; if the command produced more, the truncated output is returned
+// along with ErrDebugOutputTruncated.
+func (t *Target) DebugShell(ctx context.Context, service string, cmd string) (string, error) {
+	if !t.Supports(ProtocolFeatureDebugExec) {
+		return "", ErrUpdateHandlerNotImplemented
+	}
+	var result struct {
+		Stdout    string `json:"stdout"`
+		Truncated bool   `json:"truncated"`
+	}
+	if err := t.doJSON(ctx, "POST", "debug/exec", struct {
+		Service        string `json:"service"`
+		Cmd            string `json:"cmd"`
+		MaxOutputBytes int    `json:"max_output_bytes"`
+	}{
+		Service:        service,
+		Cmd:            cmd,
+		MaxOutputBytes: debugShellMaxOutput,
+	}, &result); err != nil {
+		return "", err
+	}
+	if len(result.Stdout) > debugShellMaxOutput {
+		result.Stdout = result.Stdout[:debugShellMaxOutput]
+		result.Truncated = true
+	}
+	if result.Truncated {
+		return result.Stdout, ErrDebugOutputTruncated
+	}
+	return result.Stdout, nil
+}
+
+// ProcessMetrics describes the resource usage of a supervised service.
+type ProcessMetrics struct {
+	PID                 int   `json:"pid"`
+	VirtualMemoryBytes  int64 `json:"virtual_memory_bytes"`
+	ResidentMemoryBytes int64 `json:"resident_memory_bytes"`
+	CPUUserNs           int64 `json:"cpu_user_ns"`
+	CPUSysNs            int64 `json:"cpu_sys_ns"`
+	OpenFDs             int   `json:"open_fds"`
+	Threads             int   `json:"threads"`
+}
+
+// GetProcessMetrics returns the resource usage of the specified service (e.g.
+// /user/scan2drive), e.g. to verify that a diverted binary behaves as
+// expected.
+func (t *Target) GetProcessMetrics(ctx context.Context, servicePath string) (ProcessMetrics, error) {
+	var m ProcessMetrics
+	if err := t.doJSON(ctx, "GET", serviceURLPath(servicePath, "metrics"), nil, &m); err != nil {
+		return ProcessMetrics{}, err
+	}
+	return m, nil
+}
+
+// CrashLog describes an unexpected exit of a supervised service.
+type CrashLog struct {
+	Service   string    `json:"service"`   // e.g. /user/scan2drive
+	ExitCode  string    `json:"exit_code"` // e.g. "exit status 2" or "signal: killed"
+	CrashTime time.Time `json:"crash_time"`
+	Stderr    string    `json:"stderr"` // last lines of standard error output
+}
+
+// GetCrashLogs returns the crashes of supervised services since the specified
+// time, e.g. since a reboot into an updated root partition. An empty (non-nil)
+// slice is returned when no service crashed.
+func (t *Target) GetCrashLogs(ctx context.Context, since time.Time) ([]CrashLog, error) {
+	var crashes []CrashLog
+	path := "service/crashlogs?since=" + url.QueryEscape(since.Format(time.RFC3339))
+	if err := t.doJSON(ctx, "GET", path, nil, &crashes); err != nil {
+		return nil, err
+	}
+	if crashes == nil {
+		crashes = []CrashLog{}
+	}
+	return crashes, nil
+}
@@ -0,0 +1,98 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrSwitchNotReversible is returned by UpdateSession.Rollback when the target
+// was switched but not rebooted, and does not support ProtocolFeatureRebootTo.
+// Switch always activates the root partition which is not currently running,
+// so until the target reboots, switching again would activate the updated
+// partition again instead of reverting.
+var ErrSwitchNotReversible = errors.New("switch cannot be undone before a reboot")
+
+// UpdateSession groups the operations of an update so that a target which is
+// left in a switched-but-not-rebooted state (e.g. because Reboot failed) is
+// rolled back, or at least detected instead of silently booting the updated
+// partition later:
+//
+//	sess, err := updater.Begin(ctx, target)
+//	if err != nil { … }
+//	// … StreamTo …
+//	if err := sess.Commit(); err != nil {
+//		return errors.Join(err, sess.Rollback())
+//	}
+type UpdateSession struct {
+	ctx    context.Context
+	target *Target
+
+	// activePartition is the active root partition at the time of Begin, or
+	// empty if the target does not report it.
+	activePartition string
+
+	switched  bool
+	rebooted  bool
+	committed bool
+}
+
+// Begin starts an UpdateSession for target, recording the currently active
+// root partition.
+func Begin(ctx context.Context, target *Target) (*UpdateSession, error) {
+	active, err := target.GetActivePartition(ctx)
+	if err != nil && err != ErrUpdateHandlerNotImplemented {
+		return nil, err
+	}
+	return &UpdateSession{
+		ctx:             ctx,
+		target:          target,
+		activePartition: active,
+	}, nil
+}
+
+// Commit switches to the updated root partition and reboots the target.
+func (s *UpdateSession) Commit() error {
+	if s.committed {
+		return fmt.Errorf("update session already committed")
+	}
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.target.Switch(); err != nil {
+		return fmt.Errorf("switch: %w", err)
+	}
+	s.switched = true
+	if err := s.target.Reboot(); err != nil {
+		return fmt.Errorf("reboot: %w", err)
+	}
+	s.rebooted = true
+	s.committed = true
+	return nil
+}
+
+// Rollback undoes a Switch which was not followed by a successful Reboot. It
+// does nothing if the target was not switched or the session was committed.
+//
+// If the target supports ProtocolFeatureRebootTo and reported its active
+// partition in Begin, that partition is made active again and the target is
+// rebooted (see RebootTo). Otherwise, an error wrapping ErrSwitchNotReversible
+// is returned: the target will then boot the updated partition on its next
+// reboot, which the caller needs to either trigger or prevent by re-running
+// the update.
+func (s *UpdateSession) Rollback() error {
+	if s.committed || !s.switched || s.rebooted {
+		return nil
+	}
+	if s.activePartition == "" {
+		return ErrSwitchNotReversible
+	}
+	if !s.target.Supports(ProtocolFeatureRebootTo) {
+		return fmt.Errorf("%w: the target will no longer boot partition %q", ErrSwitchNotReversible, s.activePartition)
+	}
+	if err := s.target.RebootTo(s.ctx, s.activePartition); err != nil {
+		return fmt.Errorf("rebooting into partition %q: %w", s.activePartition, err)
+	}
+	s.switched = false
+	return nil
+}
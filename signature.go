@@ -0,0 +1,65 @@
+package updater
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// ErrInvalidSignature is returned by ValidateImage when the image signature
+// does not verify with the configured signing key.
+var ErrInvalidSignature = errors.New("invalid image signature")
+
+// WithSigningKey configures the public key which ValidateImage uses to verify
+// image signatures. pub must be an ed25519.PublicKey or an *ecdsa.PublicKey.
+func WithSigningKey(pub crypto.PublicKey) TargetOption {
+	return func(t *Target) {
+		t.signingKey = pub
+	}
+}
+
+// ValidateImage verifies sig over the content of r using the key configured
+// via WithSigningKey and, only if the signature is valid, streams r to dest
+// (see StreamTo). No data is sent to the target if verification fails.
+//
+// ed25519 signatures are computed over the entire image (which is read into
+// memory for verification), ECDSA signatures over its SHA256 digest (ASN.1
+// encoded).
+func (t *Target) ValidateImage(ctx context.Context, dest string, r io.ReadSeeker, sig []byte) error {
+	switch pub := t.signingKey.(type) {
+	case nil:
+		return fmt.Errorf("no signing key configured, see WithSigningKey")
+
+	case ed25519.PublicKey:
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if !ed25519.Verify(pub, b, sig) {
+			return ErrInvalidSignature
+		}
+
+	case *ecdsa.PublicKey:
+		h := sha256.New()
+		if _, err := io.Copy(h, r); err != nil {
+			return err
+		}
+		if !ecdsa.VerifyASN1(pub, h.Sum(nil), sig) {
+			return ErrInvalidSignature
+		}
+
+	default:
+		return fmt.Errorf("unsupported signing key type %T", pub)
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return t.streamTo(ctx, dest, r, -1)
+}
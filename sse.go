@@ -0,0 +1,57 @@
+package updater
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// sseEvent is a server-sent event, see
+// https://html.spec.whatwg.org/multipage/server-sent-events.html
+type sseEvent struct {
+	Type string // event field, defaults to "message"
+	Data string // data fields, joined by newlines
+}
+
+// readEvents parses the text/event-stream r and calls fn for each event until r
+// returns io.EOF (nil is returned) or fn returns an error.
+func readEvents(r io.Reader, fn func(sseEvent) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var (
+		ev   sseEvent
+		data []string
+	)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// Blank line: dispatch the event, if any.
+			if data != nil {
+				ev.Data = strings.Join(data, "\n")
+				if ev.Type == "" {
+					ev.Type = "message"
+				}
+				if err := fn(ev); err != nil {
+					return err
+				}
+			}
+			ev = sseEvent{}
+			data = nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue // comment, e.g. used as keep-alive
+		}
+		field, value := line, ""
+		if idx := strings.IndexByte(line, ':'); idx > -1 {
+			field, value = line[:idx], strings.TrimPrefix(line[idx+1:], " ")
+		}
+		switch field {
+		case "event":
+			ev.Type = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,29 @@
+package updater
+
+import "context"
+
+// GetSSHKeys returns the public keys (in authorized_keys format, e.g.
+// "ssh-ed25519 AAAA… user@host") which may log in via the target’s SSH
+// server.
+func (t *Target) GetSSHKeys(ctx context.Context) ([]string, error) {
+	if !t.Supports(ProtocolFeatureSSHConfig) {
+		return nil, ErrUpdateHandlerNotImplemented
+	}
+	var keys []string
+	if err := t.doJSON(ctx, "GET", "config/ssh/authorized-keys", nil, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// SetSSHKeys replaces the public keys which may log in via the target’s SSH
+// server, e.g. to rotate keys without re-flashing any partition.
+func (t *Target) SetSSHKeys(ctx context.Context, keys []string) error {
+	if !t.Supports(ProtocolFeatureSSHConfig) {
+		return ErrUpdateHandlerNotImplemented
+	}
+	if keys == nil {
+		keys = []string{} // send [] instead of null
+	}
+	return t.doJSON(ctx, "PUT", "config/ssh/authorized-keys", keys, nil)
+}
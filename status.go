@@ -0,0 +1,121 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// NetworkInterface describes a network interface of the target device, as
+// reported by its status page.
+type NetworkInterface struct {
+	Name         string   // e.g. eth0
+	HardwareAddr string   // e.g. dc:a6:32:00:00:01
+	Addrs        []string // CIDR notation, e.g. 10.0.0.76/24
+	Up           bool
+}
+
+// GetNetworkInterfaces returns the network interfaces of the target device,
+// which is useful to verify that the device came back up with the expected IP
+// addresses after an update.
+func (t *Target) GetNetworkInterfaces(ctx context.Context) ([]NetworkInterface, error) {
+	var st struct {
+		Interfaces []NetworkInterface `json:"Interfaces"`
+	}
+	if err := t.getStatus(ctx, &st); err != nil {
+		return nil, err
+	}
+	return st.Interfaces, nil
+}
+
+// GetActivePartition returns the currently active root partition of the target
+// device, e.g. "A" or "B" (older targets might return the block device path
+// instead). Comparing the result before and after Switch and Reboot verifies
+// that the switch took effect.
+func (t *Target) GetActivePartition(ctx context.Context) (string, error) {
+	var st struct {
+		ActivePartition string `json:"active_partition"`
+	}
+	if err := t.doJSON(ctx, "GET", "update/status", nil, &st); err != nil {
+		return "", err
+	}
+	return st.ActivePartition, nil
+}
+
+// MountPoint describes a mounted file system of the target device, as in
+// /proc/mounts.
+type MountPoint struct {
+	Device     string // e.g. /dev/mmcblk0p2
+	Path       string // e.g. /
+	Filesystem string // e.g. squashfs
+	Options    string // e.g. ro,relatime
+}
+
+// GetMountPoints returns the mounted file systems of the target device, which
+// is useful to verify after an update that the expected root partition is
+// mounted at / and the boot partition at /boot.
+func (t *Target) GetMountPoints(ctx context.Context) ([]MountPoint, error) {
+	var st struct {
+		Mounts []MountPoint `json:"Mounts"`
+	}
+	if err := t.getStatus(ctx, &st); err != nil {
+		return nil, err
+	}
+	return st.Mounts, nil
+}
+
+// SystemInfo describes the hardware and software of the target device.
+type SystemInfo struct {
+	Hostname       string
+	BoardModel     string // e.g. Raspberry Pi 4 Model B Rev 1.4
+	GokrazyVersion string
+	KernelVersion  string // as reported by uname -r, e.g. 6.1.21-v8+
+	Arch           string // GOARCH, e.g. arm64 or amd64
+}
+
+// GetSystemInfo returns information about the target device, e.g. to select
+// the appropriate image for its architecture.
+func (t *Target) GetSystemInfo(ctx context.Context) (SystemInfo, error) {
+	var st struct {
+		Hostname       string `json:"Hostname"`
+		Model          string `json:"Model"`
+		GokrazyVersion string `json:"GokrazyVersion"`
+		Kernel         string `json:"Kernel"`
+		Arch           string `json:"Arch"`
+	}
+	if err := t.getStatus(ctx, &st); err != nil {
+		return SystemInfo{}, err
+	}
+	return SystemInfo{
+		Hostname:       st.Hostname,
+		BoardModel:     st.Model,
+		GokrazyVersion: st.GokrazyVersion,
+		KernelVersion:  st.Kernel,
+		Arch:           st.Arch,
+	}, nil
+}
+
+// GetLastUpdateTime returns when the target device was last updated, or the
+// zero time.Time if it was never updated via the update protocol.
+func (t *Target) GetLastUpdateTime(ctx context.Context) (time.Time, error) {
+	var st struct {
+		LastUpdate time.Time `json:"LastUpdate"`
+	}
+	if err := t.getStatus(ctx, &st); err != nil {
+		return time.Time{}, err
+	}
+	return st.LastUpdate, nil
+}
+
+// LastUpdateAge returns how long ago the target device was last updated. An
+// error is returned if it was never updated.
+func (t *Target) LastUpdateAge(ctx context.Context) (time.Duration, error) {
+	last, err := t.GetLastUpdateTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if last.IsZero() {
+		return 0, fmt.Errorf("target was never updated")
+	}
+	return time.Since(last), nil
+}
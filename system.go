@@ -0,0 +1,273 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ErrClockSkewTooLarge is returned by CheckClockSkew when the clocks of the
+// caller and the target device differ by more than the permitted threshold.
+var ErrClockSkewTooLarge = errors.New("clock skew too large")
+
+// systemTime returns the time reported by the target in the Date header, and
+// the local time at which the target was likely to have generated it.
+func (t *Target) systemTime(ctx context.Context) (remote, local time.Time, _ error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", t.baseURL+"update/features", nil)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	start := time.Now()
+	resp, err := t.httpDoer().Do(req)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	rtt := time.Since(start)
+	date := resp.Header.Get("Date")
+	if date == "" {
+		return time.Time{}, time.Time{}, fmt.Errorf("target did not send a Date header")
+	}
+	remote, err = http.ParseTime(date)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return remote, start.Add(rtt / 2), nil
+}
+
+// SystemTime returns the current time of the target device, as reported in the
+// HTTP Date header (i.e. with second granularity).
+func (t *Target) SystemTime(ctx context.Context) (time.Time, error) {
+	remote, _, err := t.systemTime(ctx)
+	return remote, err
+}
+
+// SystemTimeSkew returns the difference between the clock of the target device
+// and the local clock. A positive duration means the device clock is ahead.
+//
+// The Date header has second granularity, so skews below one second cannot be
+// detected.
+func (t *Target) SystemTimeSkew(ctx context.Context) (time.Duration, error) {
+	remote, local, err := t.systemTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return remote.Sub(local.Truncate(time.Second)), nil
+}
+
+// CheckClockSkew returns an error wrapping ErrClockSkewTooLarge if the clock of
+// the target device differs from the local clock by more than max.
+func (t *Target) CheckClockSkew(ctx context.Context, max time.Duration) error {
+	skew, err := t.SystemTimeSkew(ctx)
+	if err != nil {
+		return err
+	}
+	if skew > max || skew < -max {
+		return fmt.Errorf("%w: target clock is off by %v (max %v)", ErrClockSkewTooLarge, skew, max)
+	}
+	return nil
+}
+
+// SyncTime sets the clock of the target device to the local time, which is
+// useful for devices without a real-time clock or network time access. The
+// time sent is adjusted by half the round-trip time (as measured by Ping) to
+// account for the transmission delay.
+func (t *Target) SyncTime(ctx context.Context) error {
+	if !t.Supports(ProtocolFeatureTimeSync) {
+		return ErrUpdateHandlerNotImplemented
+	}
+	start := time.Now()
+	if err := t.Ping(ctx); err != nil {
+		return err
+	}
+	rtt := time.Since(start)
+	return t.doJSON(ctx, "POST", "system/time", struct {
+		Time string `json:"time"`
+	}{
+		Time: time.Now().Add(rtt / 2).Format(time.RFC3339Nano),
+	}, nil)
+}
+
+// defaultGracefulStopTimeout is used by GracefulStop when ctx has no deadline.
+const defaultGracefulStopTimeout = 30 * time.Second
+
+// GracefulStopResult describes how the supervised services of the target
+// stopped in response to GracefulStop.
+type GracefulStopResult struct {
+	// ExitedServices exited by themselves after receiving SIGTERM.
+	ExitedServices []string
+
+	// ForcedServices did not exit within the timeout and were killed.
+	ForcedServices []string
+
+	// ElapsedTime is the duration of the GracefulStop request.
+	ElapsedTime time.Duration
+}
+
+// GracefulStop sends SIGTERM to all supervised services of the target, waits
+// for them to exit and then shuts down the target. Services which have not
+// exited by the deadline of ctx (or after 30 seconds if ctx has no deadline)
+// are killed.
+func (t *Target) GracefulStop(ctx context.Context) (GracefulStopResult, error) {
+	if !t.Supports(ProtocolFeatureGracefulStop) {
+		return GracefulStopResult{}, ErrUpdateHandlerNotImplemented
+	}
+	timeout := defaultGracefulStopTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		// Leave a little time for the response to arrive before ctx is done.
+		timeout = time.Until(deadline) * 9 / 10
+	}
+	start := time.Now()
+	var stop struct {
+		ExitedServices []string `json:"exited_services"`
+		ForcedServices []string `json:"forced_services"`
+	}
+	if err := t.doJSON(ctx, "POST", "gracefulstop", struct {
+		TimeoutSeconds float64 `json:"timeout_seconds"`
+	}{
+		TimeoutSeconds: timeout.Seconds(),
+	}, &stop); err != nil {
+		return GracefulStopResult{}, err
+	}
+	return GracefulStopResult{
+		ExitedServices: stop.ExitedServices,
+		ForcedServices: stop.ForcedServices,
+		ElapsedTime:    time.Since(start),
+	}, nil
+}
+
+// BootCounter is the boot counter which reverts a failed test boot (see
+// Testboot) to the previous root partition.
+type BootCounter struct {
+	Value int // number of boot attempts so far
+	Max   int // boot attempts before reverting
+
+	// Remaining is computed as Max-Value (but not negative).
+	Remaining int
+}
+
+// GetBootCounter returns the boot counter of the target.
+func (t *Target) GetBootCounter(ctx context.Context) (BootCounter, error) {
+	var bc struct {
+		Value int `json:"value"`
+		Max   int `json:"max"`
+	}
+	if err := t.doJSON(ctx, "GET", "update/bootcounter", nil, &bc); err != nil {
+		return BootCounter{}, err
+	}
+	remaining := bc.Max - bc.Value
+	if remaining < 0 {
+		remaining = 0
+	}
+	return BootCounter{
+		Value:     bc.Value,
+		Max:       bc.Max,
+		Remaining: remaining,
+	}, nil
+}
+
+// SetBootCounter sets the boot counter of the target to value, e.g. 0 to reset
+// it.
+func (t *Target) SetBootCounter(ctx context.Context, value int) error {
+	return t.doJSON(ctx, "POST", "update/bootcounter", struct {
+		Value int `json:"value"`
+	}{
+		Value: value,
+	}, nil)
+}
+
+// ErrDeviceTooHot is returned (wrapped) by CheckThermalSafe when the CPU
+// temperature of the target device exceeds the permitted maximum.
+var ErrDeviceTooHot = errors.New("device too hot")
+
+// ThermalInfo describes the thermal state of the target device.
+type ThermalInfo struct {
+	CPUTempCelsius float64 `json:"cpu_temp_celsius"`
+
+	// ThrottleActive is true if the CPU is currently throttled because of
+	// its temperature.
+	ThrottleActive bool `json:"throttle_active"`
+
+	// ThrottleHistory is true if the CPU was throttled since boot.
+	ThrottleHistory bool `json:"throttle_history"`
+}
+
+// GetThermal returns the thermal state of the target device.
+func (t *Target) GetThermal(ctx context.Context) (ThermalInfo, error) {
+	var info ThermalInfo
+	if err := t.doJSON(ctx, "GET", "system/thermal", nil, &info); err != nil {
+		return ThermalInfo{}, err
+	}
+	return info, nil
+}
+
+// CheckThermalSafe returns an error wrapping ErrDeviceTooHot if the CPU
+// temperature of the target device exceeds maxTempC.
+func (t *Target) CheckThermalSafe(ctx context.Context, maxTempC float64) error {
+	info, err := t.GetThermal(ctx)
+	if err != nil {
+		return err
+	}
+	if info.CPUTempCelsius > maxTempC {
+		return fmt.Errorf("%w: CPU at %.1f°C (max %.1f°C)", ErrDeviceTooHot, info.CPUTempCelsius, maxTempC)
+	}
+	return nil
+}
+
+// SetPower turns the power domain of the specified peripheral component (e.g.
+// usb-hub or poe) of the target on or off.
+func (t *Target) SetPower(ctx context.Context, component string, on bool) error {
+	if !t.Supports(ProtocolFeaturePowerControl) {
+		return ErrUpdateHandlerNotImplemented
+	}
+	return t.doJSON(ctx, "POST", "power/"+url.PathEscape(component), struct {
+		On bool `json:"on"`
+	}{
+		On: on,
+	}, nil)
+}
+
+// GetPower returns whether the power domain of the specified peripheral
+// component is on.
+func (t *Target) GetPower(ctx context.Context, component string) (bool, error) {
+	if !t.Supports(ProtocolFeaturePowerControl) {
+		return false, ErrUpdateHandlerNotImplemented
+	}
+	var power struct {
+		On bool `json:"on"`
+	}
+	if err := t.doJSON(ctx, "GET", "power/"+url.PathEscape(component), nil, &power); err != nil {
+		return false, err
+	}
+	return power.On, nil
+}
+
+// StorageHealth describes the wear of the target device’s storage (SD card or
+// eMMC).
+type StorageHealth struct {
+	Device                  string  `json:"device"` // e.g. /dev/mmcblk0
+	TotalWrittenGB          float64 `json:"total_written_gb"`
+	EnduranceUsedPercent    float64 `json:"endurance_used_percent"`
+	ErrorCount              int     `json:"error_count"`
+	LifetimeEstimatePercent float64 `json:"lifetime_estimate_percent"`
+}
+
+// GetStorageHealth returns the wear of the target device’s storage.
+// ErrUpdateHandlerNotImplemented is returned when the storage does not expose
+// health data (SMART or eMMC Extended CSD).
+func (t *Target) GetStorageHealth(ctx context.Context) (StorageHealth, error) {
+	if !t.Supports(ProtocolFeatureStorageHealth) {
+		return StorageHealth{}, ErrUpdateHandlerNotImplemented
+	}
+	var health StorageHealth
+	if err := t.doJSON(ctx, "GET", "storage/health", nil, &health); err != nil {
+		return StorageHealth{}, err
+	}
+	return health, nil
+}
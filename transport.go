@@ -0,0 +1,27 @@
+package updater
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// WithUnixSocket makes the Target connect to the Unix domain socket at path
+// instead of the host of the base URL, e.g. to control a gokrazy instance
+// running on the same machine (in qemu or as a simulator) without TCP
+// overhead. The base URL should then be http://localhost/, and the gokrazy
+// server needs to listen on the socket.
+//
+// The HTTPDoer passed to NewTarget is replaced.
+func WithUnixSocket(path string) TargetOption {
+	return func(t *Target) {
+		t.baseDoer = &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", path)
+				},
+			},
+		}
+	}
+}
@@ -4,6 +4,9 @@ package updater
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -13,10 +16,15 @@ import (
 	"hash/crc32"
 	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 // ErrUpdateHandlerNotImplemented is returned when the requested update
@@ -33,21 +41,59 @@ type HTTPDoer interface {
 
 // Target represents a gokrazy installation to be updated.
 type Target struct {
-	doer HTTPDoer
+	mu       sync.RWMutex // protects baseDoer, doer and lockToken
+	baseDoer HTTPDoer     // as passed to NewTarget or SetHTTPDoer
+	doer     HTTPDoer     // baseDoer wrapped in middleware
+
+	// middleware wraps the HTTPDoer, e.g. to add authentication.
+	middleware []func(HTTPDoer) HTTPDoer
 
 	baseURL  string
 	supports []string
 
 	eeprom EEPROMVersion
+
+	resume ResumeState
+
+	lockToken LockToken
+
+	logger *slog.Logger
+
+	signingKey crypto.PublicKey
+
+	metrics targetMetrics
+
+	// opts are retained to create a new Target after a reboot.
+	opts []TargetOption
+}
+
+// A TargetOption configures optional behavior of a Target.
+type TargetOption func(*Target)
+
+// WithLogger directs the log messages of the Target to logger instead of
+// slog.Default().
+func WithLogger(logger *slog.Logger) TargetOption {
+	return func(t *Target) {
+		t.logger = logger
+	}
 }
 
 // NewTarget queries the target for supported update protocol features and
 // returns a ready-to-use updater Target.
-func NewTarget(baseURL string, httpClient HTTPDoer) (*Target, error) {
+func NewTarget(baseURL string, httpClient HTTPDoer, opts ...TargetOption) (*Target, error) {
 	target := &Target{
-		baseURL: baseURL,
-		doer:    httpClient,
+		baseURL:  baseURL,
+		baseDoer: httpClient,
+		opts:     opts,
 	}
+	for _, opt := range opts {
+		opt(target)
+	}
+	target.doer = target.wrap(target.baseDoer)
+	if target.logger == nil {
+		target.logger = slog.Default()
+	}
+	target.logger = target.logger.With("component", "updater")
 	if err := target.requestFeatures(); err != nil {
 		return nil, err
 	}
@@ -55,6 +101,30 @@ func NewTarget(baseURL string, httpClient HTTPDoer) (*Target, error) {
 	return target, nil
 }
 
+// SetHTTPDoer replaces the HTTPDoer used for all subsequent requests, e.g. to
+// use freshly rotated credentials. Middleware configured via TargetOptions
+// (e.g. WithBasicAuth) is applied to doer as well. Protocol features are not
+// re-negotiated. SetHTTPDoer is safe to call concurrently with other methods.
+func (t *Target) SetHTTPDoer(doer HTTPDoer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.baseDoer = doer
+	t.doer = t.wrap(doer)
+}
+
+func (t *Target) wrap(doer HTTPDoer) HTTPDoer {
+	for _, mw := range t.middleware {
+		doer = mw(doer)
+	}
+	return doer
+}
+
+func (t *Target) httpDoer() HTTPDoer {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.doer
+}
+
 // A ProtocolFeature represents an optionally available feature of the update
 // protocol, i.e. features that might possibly be missing in older gokrazy
 // installations.
@@ -70,6 +140,108 @@ const (
 	// X-Gokrazy-Update-Hash HTTP header and at least the “crc32” value, which
 	// is significantly faster than SHA256, which is used by default.
 	ProtocolFeatureUpdateHash ProtocolFeature = "updatehash"
+
+	// ProtocolFeatureResume signals that the target accepts PATCH requests
+	// with a Content-Range header to continue an interrupted update, and
+	// reports the number of bytes it committed in the X-Gokrazy-Update-Offset
+	// header of HEAD responses.
+	ProtocolFeatureResume ProtocolFeature = "resume"
+
+	// ProtocolFeatureUpdateLock signals that the target implements the
+	// /update/lock handler and checks the X-Gokrazy-Update-Lock HTTP header.
+	ProtocolFeatureUpdateLock ProtocolFeature = "updatelock"
+
+	// ProtocolFeatureFreeze signals that the target can pause (freeze) and
+	// resume (thaw) supervised services.
+	ProtocolFeatureFreeze ProtocolFeature = "freeze"
+
+	// ProtocolFeatureChunkedUpload signals that the target accepts updates in
+	// individually verified chunks, see StreamToChunked.
+	ProtocolFeatureChunkedUpload ProtocolFeature = "chunkedupload"
+
+	// ProtocolFeatureFirmwareUpdate signals that individual firmware files on
+	// the boot partition can be updated, see FirmwareUpdate.
+	ProtocolFeatureFirmwareUpdate ProtocolFeature = "firmwareupdate"
+
+	// ProtocolFeatureRebootTo signals that the target can switch to a named
+	// root partition and reboot in a single request, see RebootTo.
+	ProtocolFeatureRebootTo ProtocolFeature = "rebootto"
+
+	// ProtocolFeatureHealthEndpoint signals that the target implements the
+	// /health handler, see HealthCheck.
+	ProtocolFeatureHealthEndpoint ProtocolFeature = "health"
+
+	// ProtocolFeatureGracefulStop signals that the target implements the
+	// /gracefulstop handler, see GracefulStop.
+	ProtocolFeatureGracefulStop ProtocolFeature = "gracefulstop"
+
+	// ProtocolFeatureRecovery signals that the target has a recovery
+	// partition, see RebootIntoRecovery.
+	ProtocolFeatureRecovery ProtocolFeature = "recovery"
+
+	// ProtocolFeatureWifiConfig signals that the target implements the
+	// /config/wifi handler, see ConfigureWifi.
+	ProtocolFeatureWifiConfig ProtocolFeature = "wificonfig"
+
+	// ProtocolFeatureContentAddressable signals that the target can update
+	// partitions from a content-addressed blob cache, see StreamToCA.
+	ProtocolFeatureContentAddressable ProtocolFeature = "ca"
+
+	// ProtocolFeatureTimeSync signals that the target’s clock can be set via
+	// the /system/time handler, see SyncTime.
+	ProtocolFeatureTimeSync ProtocolFeature = "timesync"
+
+	// ProtocolFeatureContainers signals that the target runs OCI containers
+	// and implements the /containers handler, see GetContainerStatus.
+	ProtocolFeatureContainers ProtocolFeature = "containers"
+
+	// ProtocolFeatureRuntimeFlags signals that the flags of supervised
+	// services can be changed at runtime, see SetFlag.
+	ProtocolFeatureRuntimeFlags ProtocolFeature = "runtimeflags"
+
+	// ProtocolFeatureDebugExec signals that the target implements the
+	// /debug/exec handler, see DebugShell.
+	ProtocolFeatureDebugExec ProtocolFeature = "debugexec"
+
+	// ProtocolFeaturePowerControl signals that the target can toggle power
+	// to peripherals, see SetPower.
+	ProtocolFeaturePowerControl ProtocolFeature = "powercontrol"
+
+	// ProtocolFeatureBenchmark signals that the target implements the
+	// /update/<dest>/benchmark handler, see BenchmarkFlash.
+	ProtocolFeatureBenchmark ProtocolFeature = "benchmark"
+
+	// ProtocolFeatureZstdTransfer signals that the target accepts
+	// zstd-compressed updates (Content-Encoding: zstd). StreamTo compresses
+	// updates of unknown size only: updates with a known size (which is sent
+	// as Content-Length), resumed updates (see WithResumeStore) and chunked
+	// updates (see StreamToChunked) are sent uncompressed.
+	ProtocolFeatureZstdTransfer ProtocolFeature = "zstdtransfer"
+
+	// ProtocolFeatureCmdlineUpdate signals that the kernel command line can
+	// be changed without updating the boot partition, see
+	// UpdateKernelCmdline.
+	ProtocolFeatureCmdlineUpdate ProtocolFeature = "cmdlineupdate"
+
+	// ProtocolFeatureStorageHealth signals that the target implements the
+	// /storage/health handler, see GetStorageHealth.
+	ProtocolFeatureStorageHealth ProtocolFeature = "storagehealth"
+
+	// ProtocolFeatureDNSConfig signals that the resolver configuration of the
+	// target can be changed at runtime, see SetDNS.
+	ProtocolFeatureDNSConfig ProtocolFeature = "dnsconfig"
+
+	// ProtocolFeatureSupportBundle signals that the target implements the
+	// /debug/support-bundle handler, see ExportSupportBundle.
+	ProtocolFeatureSupportBundle ProtocolFeature = "supportbundle"
+
+	// ProtocolFeatureSSHConfig signals that the authorized SSH keys of the
+	// target can be managed at runtime, see SetSSHKeys.
+	ProtocolFeatureSSHConfig ProtocolFeature = "sshconfig"
+
+	// ProtocolFeatureFileChecksum signals that the target reports the SHA256
+	// of files received by the /uploadtemp/ handler, see GetFileChecksum.
+	ProtocolFeatureFileChecksum ProtocolFeature = "filechecksum"
 )
 
 // Supports returns whether the target is known to support the specified update
@@ -98,28 +270,197 @@ func (t *Target) Supports(feature ProtocolFeature) bool {
 //
 // You can keep track of progress by passing in an io.TeeReader(r,
 // &countingWriter{}).
+//
+// When a ResumeState was configured using WithResumeStore and the target
+// supports ProtocolFeatureResume, an interrupted update will be continued from
+// the last saved offset on the next call. Such updates are not compressed,
+// even if the target supports ProtocolFeatureZstdTransfer.
 func (t *Target) StreamTo(dest string, r io.Reader) error {
-	updateHash := t.Supports("updatehash")
-	var hash hash.Hash
-	if updateHash {
-		hash = crc32.NewIEEE()
+	return t.streamTo(context.Background(), dest, r, -1)
+}
+
+// StreamToWithSize is like StreamTo, but sends the size of r’s content (in
+// bytes) as Content-Length header.
+func (t *Target) StreamToWithSize(ctx context.Context, dest string, r io.Reader, size int64) error {
+	return t.streamTo(ctx, dest, r, size)
+}
+
+// StreamToFromFile is like StreamTo, but streams the content of the local file
+// localPath (e.g. root.img).
+func (t *Target) StreamToFromFile(ctx context.Context, dest, localPath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return t.StreamToWithSize(ctx, dest, f, st.Size())
+}
+
+func (t *Target) streamTo(ctx context.Context, dest string, r io.Reader, size int64) error {
+	start := time.Now()
+	var err error
+	if t.resume != nil && t.Supports(ProtocolFeatureResume) {
+		err = t.streamToResumable(ctx, dest, r)
 	} else {
-		hash = sha256.New()
+		hash := t.newUpdateHash()
+		err = t.sendUpdate(ctx, dest, io.TeeReader(r, hash), size, hash.Sum)
 	}
-	req, err := http.NewRequest(http.MethodPut, t.baseURL+"update/"+dest, io.TeeReader(r, hash))
 	if err != nil {
 		return err
 	}
-	if updateHash {
+	t.metrics.recordUpdate(start)
+	return nil
+}
+
+// StreamToWithRetry is like StreamTo, but retries the update up to maxRetries
+// times (starting from the beginning of r) if the hash computed by the target
+// does not match, e.g. because of data corruption in transit. Other errors are
+// returned immediately.
+func (t *Target) StreamToWithRetry(ctx context.Context, dest string, r io.ReadSeeker, maxRetries int) error {
+	for attempt := 0; ; attempt++ {
+		err := t.streamTo(ctx, dest, r, -1)
+		if !errors.Is(err, ErrHashMismatch) || attempt >= maxRetries {
+			return err
+		}
+		t.logger.Warn("checksum mismatch, retrying",
+			"method", "StreamToWithRetry",
+			"dest", dest,
+			"err", err,
+			"attempt", attempt+1,
+			"max_retries", maxRetries)
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+}
+
+// StreamToBytes is like StreamTo, but for images which are already held in
+// memory: the hash is computed before the request is sent, and data is sent
+// with a Content-Length header.
+func (t *Target) StreamToBytes(ctx context.Context, dest string, data []byte) error {
+	start := time.Now()
+	hash := t.newUpdateHash()
+	hash.Write(data)
+	sum := hash.Sum(nil)
+	err := t.sendUpdate(ctx, dest, bytes.NewReader(data), int64(len(data)), func([]byte) []byte {
+		return sum
+	})
+	if err != nil {
+		return err
+	}
+	t.metrics.recordUpdate(start)
+	return nil
+}
+
+// StreamToGzip is like StreamTo, but for gzip-compressed images: r is
+// decompressed before sending it to the target, so that the hash covers the
+// bytes the target writes.
+func (t *Target) StreamToGzip(ctx context.Context, dest string, r io.Reader) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	return t.streamTo(ctx, dest, zr, -1)
+}
+
+// newUpdateHash returns the hash the target will compute over the update
+// content, as negotiated via ProtocolFeatureUpdateHash.
+func (t *Target) newUpdateHash() hash.Hash {
+	if t.Supports(ProtocolFeatureUpdateHash) {
+		return crc32.NewIEEE()
+	}
+	return sha256.New()
+}
+
+// sendUpdate sends body (of size bytes, or -1 if unknown) to the specified
+// update destination and verifies the hash the target responds with against
+// sum, which is called once body has been sent.
+//
+// If the target supports ProtocolFeatureZstdTransfer and size is unknown, body
+// is compressed.
+func (t *Target) sendUpdate(ctx context.Context, dest string, body io.Reader, size int64, sum func([]byte) []byte) error {
+	var contentEncoding string
+	// Compressing would make the Content-Length unknown, so updates of known
+	// size are sent as-is.
+	if size < 0 && t.Supports(ProtocolFeatureZstdTransfer) {
+		body = compressZstd(body)
+		contentEncoding = "zstd"
+	}
+	req, err := t.newUpdateRequest(ctx, http.MethodPut, dest, body, size)
+	if err != nil {
+		return err
+	}
+	if contentEncoding != "" {
+		req.Header.Set("Content-Encoding", contentEncoding)
+	}
+	return t.doUpdate(req, sum)
+}
+
+// compressZstd returns a reader of the zstd-compressed content of r. The
+// returned reader must be closed (as the HTTP client does with request
+// bodies) to stop compression early.
+func compressZstd(r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		zw, err := zstd.NewWriter(pw)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(zw, r); err != nil {
+			zw.Close()
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(zw.Close())
+	}()
+	return pr
+}
+
+func (t *Target) newUpdateRequest(ctx context.Context, method, dest string, body io.Reader, size int64) (*http.Request, error) {
+	body = &countingReader{r: body, n: &t.metrics.bytesTransferred}
+	req, err := http.NewRequestWithContext(ctx, method, t.baseURL+"update/"+dest, body)
+	if err != nil {
+		return nil, err
+	}
+	if size >= 0 {
+		req.ContentLength = size
+	}
+	if t.Supports(ProtocolFeatureUpdateHash) {
 		req.Header.Set("X-Gokrazy-Update-Hash", "crc32")
 	}
-	resp, err := t.doer.Do(req)
+	t.setLockHeader(req)
+	return req, nil
+}
+
+// setLockHeader sends the token of the update lock held via AcquireUpdateLock
+// (if any) along with req, which writes to a partition.
+func (t *Target) setLockHeader(req *http.Request) {
+	t.mu.RLock()
+	lockToken := t.lockToken
+	t.mu.RUnlock()
+	if lockToken != "" && t.Supports(ProtocolFeatureUpdateLock) {
+		req.Header.Set(updateLockHeader, string(lockToken))
+	}
+}
+
+// doUpdate sends the update request req and verifies the hash the target
+// responds with against sum, which is called once the request body has been
+// sent.
+func (t *Target) doUpdate(req *http.Request, sum func([]byte) []byte) error {
+	resp, err := t.httpDoer().Do(req)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	if got, want := resp.StatusCode, http.StatusOK; got != want {
 		body, _ := ioutil.ReadAll(resp.Body)
-		return fmt.Errorf("unexpected HTTP status code: got %v, want %v (body %q)", resp.Status, want, string(body))
+		return &statusError{code: got, body: string(body)}
 	}
 	remoteHash, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -133,30 +474,192 @@ func (t *Target) StreamTo(dest string, r io.Reader) error {
 	if err != nil {
 		return err
 	}
-	if got, want := decoded[:n], hash.Sum(nil); !bytes.Equal(got, want) {
-		return fmt.Errorf("unexpected checksum: got %x, want %x", got, want)
+	if got, want := decoded[:n], sum(nil); !bytes.Equal(got, want) {
+		return &checksumError{got: got, want: want}
 	}
 	return nil
 }
 
+// FirmwareUpdate replaces the firmware file filename (e.g. start4.elf or
+// fixup4.dat) on the boot partition with the content of r, without updating
+// the rest of the boot partition. The target’s SHA256 of the written file is
+// verified.
+func (t *Target) FirmwareUpdate(ctx context.Context, filename string, r io.Reader) error {
+	if !t.Supports(ProtocolFeatureFirmwareUpdate) {
+		return ErrUpdateHandlerNotImplemented
+	}
+	if filename == "" || strings.ContainsAny(filename, "/\\") {
+		return fmt.Errorf("invalid firmware file name %q", filename)
+	}
+	hash := sha256.New()
+	req, err := t.newUpdateRequest(ctx, http.MethodPut, "firmware/"+filename, io.TeeReader(r, hash), -1)
+	if err != nil {
+		return err
+	}
+	req.Header.Del("X-Gokrazy-Update-Hash") // always SHA256
+	return t.doUpdate(req, hash.Sum)
+}
+
+// UpdateKernelCmdline sets the specified kernel command line parameters (e.g.
+// {"console": "ttyAMA0,115200"}; an empty value results in a parameter without
+// value) by rewriting only cmdline.txt instead of the whole boot partition.
+// The new effective kernel command line is returned.
+func (t *Target) UpdateKernelCmdline(ctx context.Context, args map[string]string) (string, error) {
+	if !t.Supports(ProtocolFeatureCmdlineUpdate) {
+		return "", ErrUpdateHandlerNotImplemented
+	}
+	var resp struct {
+		Cmdline string `json:"cmdline"`
+	}
+	if err := t.doUpdateJSON(ctx, "POST", "update/cmdline", struct {
+		Args map[string]string `json:"args"`
+	}{
+		Args: args,
+	}, &resp); err != nil {
+		return "", err
+	}
+	return resp.Cmdline, nil
+}
+
+// ErrHashMismatch is returned (wrapped) when the hash computed by the target
+// does not match the hash of the data that was sent, e.g. because of data
+// corruption in transit. Use errors.Is to check for it.
+var ErrHashMismatch = errors.New("hash mismatch")
+
+// checksumError is returned when the hash computed by the target does not match
+// the hash of the data that was sent.
+type checksumError struct {
+	got, want []byte
+}
+
+func (e *checksumError) Error() string {
+	return fmt.Sprintf("unexpected checksum: got %x, want %x", e.got, e.want)
+}
+
+func (e *checksumError) Is(target error) bool {
+	return target == ErrHashMismatch
+}
+
 // Put streams a file to the specified HTTP endpoint, without verifying its
 // hash. This is not suited for updating the system, which should be done via
 // StreamTo() instead. This function is useful for the /uploadtemp/ handler.
 func (t *Target) Put(dest string, r io.Reader) error {
-	req, err := http.NewRequest(http.MethodPut, t.baseURL+dest, r)
+	_, err := t.put(context.Background(), dest, r, -1)
+	return err
+}
+
+// put sends r (of size bytes, or -1 if unknown) to dest and returns the
+// response headers.
+func (t *Target) put(ctx context.Context, dest string, r io.Reader, size int64) (http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, t.baseURL+dest, r)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if size >= 0 {
+		req.ContentLength = size
 	}
-	resp, err := t.doer.Do(req)
+	resp, err := t.httpDoer().Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer resp.Body.Close()
 	if got, want := resp.StatusCode, http.StatusOK; got != want {
 		if resp.StatusCode == http.StatusNotFound {
-			return fmt.Errorf("/uploadtemp/ handler not found, is your gokrazy installation too old?")
+			return nil, fmt.Errorf("/uploadtemp/ handler not found, is your gokrazy installation too old?")
 		}
 		body, _ := ioutil.ReadAll(resp.Body)
-		return fmt.Errorf("unexpected HTTP status code: got %v, want %v (body %q)", resp.Status, want, strings.TrimSpace(string(body)))
+		return nil, fmt.Errorf("unexpected HTTP status code: got %v, want %v (body %q)", resp.Status, want, strings.TrimSpace(string(body)))
+	}
+	return resp.Header, nil
+}
+
+// SendFile uploads the local file localPath to remotePath (e.g.
+// uploadtemp/scan2drive), see Put. When the target reports the SHA256 of the
+// received file in the X-Gokrazy-File-Hash response header, it is verified.
+func (t *Target) SendFile(ctx context.Context, remotePath, localPath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	header, err := t.put(ctx, remotePath, io.TeeReader(f, hash), st.Size())
+	if err != nil {
+		return err
+	}
+	if header.Get(fileHashHeader) == "" {
+		return nil // target does not support verification
+	}
+	return verifyFileHash(header, hash.Sum(nil))
+}
+
+// PutVerified is like Put, but verifies the SHA256 of r against the hash the
+// target reports for the received file. An error wrapping ErrHashMismatch is
+// returned if they differ, and ErrUpdateHandlerNotImplemented if the target
+// does not report hashes.
+func (t *Target) PutVerified(ctx context.Context, dest string, r io.Reader) error {
+	hash := sha256.New()
+	header, err := t.put(ctx, dest, io.TeeReader(r, hash), readerSize(r))
+	if err != nil {
+		return err
+	}
+	if header.Get(fileHashHeader) == "" {
+		return ErrUpdateHandlerNotImplemented
+	}
+	return verifyFileHash(header, hash.Sum(nil))
+}
+
+// ErrFileNotFound is returned by GetFileChecksum when the target has no file at
+// the specified path.
+var ErrFileNotFound = errors.New("file not found on target")
+
+// GetFileChecksum returns the hex SHA256 of the file the target received at
+// remotePath (e.g. uploadtemp/scan2drive, see Put), so that an upload can be
+// verified without downloading it again. ErrUpdateHandlerNotImplemented is
+// returned if the target does not support ProtocolFeatureFileChecksum.
+func (t *Target) GetFileChecksum(ctx context.Context, remotePath string) (string, error) {
+	if !t.Supports(ProtocolFeatureFileChecksum) {
+		return "", ErrUpdateHandlerNotImplemented
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(remotePath, "/"), "uploadtemp/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.baseURL+"uploadtemp/"+name+"/sha256", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := t.httpDoer().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("%s: %w", remotePath, ErrFileNotFound)
+	}
+	if got, want := resp.StatusCode, http.StatusOK; got != want {
+		return "", &statusError{code: got, body: strings.TrimSpace(string(body))}
+	}
+	sum := strings.TrimSpace(string(body))
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid SHA256 %q", sum)
+	}
+	return sum, nil
+}
+
+// verifyFileHash compares the hex SHA256 in the fileHashHeader with sum.
+func verifyFileHash(header http.Header, sum []byte) error {
+	remote, err := hex.DecodeString(header.Get(fileHashHeader))
+	if err != nil {
+		return fmt.Errorf("decoding %s header: %v", fileHashHeader, err)
+	}
+	if !bytes.Equal(remote, sum) {
+		return &checksumError{got: remote, want: sum}
 	}
 	return nil
 }
@@ -168,7 +671,7 @@ func (t *Target) Switch() error {
 	if err != nil {
 		return err
 	}
-	resp, err := t.doer.Do(req)
+	resp, err := t.httpDoer().Do(req)
 	if err != nil {
 		return err
 	}
@@ -186,7 +689,7 @@ func (t *Target) Testboot() error {
 	if err != nil {
 		return err
 	}
-	resp, err := t.doer.Do(req)
+	resp, err := t.httpDoer().Do(req)
 	if err != nil {
 		return err
 	}
@@ -203,7 +706,7 @@ func (t *Target) Reboot() error {
 	if err != nil {
 		return err
 	}
-	resp, err := t.doer.Do(req)
+	resp, err := t.httpDoer().Do(req)
 	if err != nil {
 		return err
 	}
@@ -222,7 +725,7 @@ func (t *Target) RebootWithoutKexec() error {
 	if err != nil {
 		return err
 	}
-	resp, err := t.doer.Do(req)
+	resp, err := t.httpDoer().Do(req)
 	if err != nil {
 		return err
 	}
@@ -233,6 +736,25 @@ func (t *Target) RebootWithoutKexec() error {
 	return nil
 }
 
+// RebootTo atomically makes the named root partition (e.g. "B") active and
+// reboots the target, closing the window between Switch and Reboot in which a
+// crash would boot the wrong partition.
+func (t *Target) RebootTo(ctx context.Context, partition string) error {
+	if !t.Supports(ProtocolFeatureRebootTo) {
+		return ErrUpdateHandlerNotImplemented
+	}
+	return t.doJSON(ctx, "POST", "reboot?partition="+url.QueryEscape(partition), nil, nil)
+}
+
+// RebootIntoRecovery reboots the target into its recovery partition, which is
+// useful for re-flashing a target on which neither root partition boots.
+func (t *Target) RebootIntoRecovery(ctx context.Context) error {
+	if !t.Supports(ProtocolFeatureRecovery) {
+		return ErrUpdateHandlerNotImplemented
+	}
+	return t.doJSON(ctx, "POST", "reboot?target=recovery", nil, nil)
+}
+
 // Divert makes gokrazy use the temporary binary (diversion) instead of
 // /user/<basename>. Includes an automatic service restart.
 func (t *Target) Divert(path, diversion string, serviceFlags, commandLineFlags []string) error {
@@ -240,11 +762,7 @@ func (t *Target) Divert(path, diversion string, serviceFlags, commandLineFlags [
 	if err != nil {
 		return err
 	}
-	body, err := json.Marshal(struct {
-		Path      string
-		Diversion string
-		Flags     []string
-	}{
+	body, err := json.Marshal(DivertInfo{
 		Path:      path,
 		Diversion: diversion,
 		Flags:     append(serviceFlags, commandLineFlags...),
@@ -258,7 +776,7 @@ func (t *Target) Divert(path, diversion string, serviceFlags, commandLineFlags [
 		return err
 	}
 	var resp *http.Response
-	resp, err = t.doer.Do(req)
+	resp, err = t.httpDoer().Do(req)
 	if err != nil {
 		return err
 	}
@@ -277,7 +795,7 @@ func (t *Target) Divert(path, diversion string, serviceFlags, commandLineFlags [
 		if err != nil {
 			return err
 		}
-		resp, err = t.doer.Do(req)
+		resp, err = t.httpDoer().Do(req)
 		if err != nil {
 			return err
 		}
@@ -289,6 +807,47 @@ func (t *Target) Divert(path, diversion string, serviceFlags, commandLineFlags [
 	return nil
 }
 
+// PrewarmConnection establishes a connection to the target (including the TLS
+// handshake, if any) ahead of time, so that a subsequent StreamTo can re-use the
+// idle connection from the HTTP client’s pool instead of paying the connection
+// setup cost. This only has an effect if the HTTPDoer pools connections, like
+// *http.Client does.
+func (t *Target) PrewarmConnection(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, t.baseURL+"update/features", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := t.httpDoer().Do(req)
+	if err != nil {
+		return err
+	}
+	// The connection is only returned to the pool once the body was read
+	// until EOF and closed.
+	io.Copy(ioutil.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// DivertInfo describes a diversion, i.e. a temporary binary which gokrazy runs
+// instead of /user/<basename>.
+type DivertInfo struct {
+	Path      string   // e.g. /user/scan2drive
+	Diversion string   // e.g. /uploadtemp/scan2drive
+	Flags     []string // service flags followed by command line flags
+}
+
+// ListDiversions returns the currently active diversions, as configured via
+// Divert.
+func (t *Target) ListDiversions(ctx context.Context) ([]DivertInfo, error) {
+	var diversions []DivertInfo
+	if err := t.doJSON(ctx, "GET", "divert/list", nil, &diversions); err != nil {
+		return nil, err
+	}
+	if diversions == nil {
+		diversions = []DivertInfo{}
+	}
+	return diversions, nil
+}
+
 // InstalledEEPROM returns the Raspberry Pi EEPROM version currently installed
 // on the target device.
 func (t *Target) InstalledEEPROM() EEPROMVersion {
@@ -301,7 +860,7 @@ func (t *Target) requestFeatures() error {
 		return err
 	}
 
-	resp, err := t.doer.Do(req)
+	resp, err := t.httpDoer().Do(req)
 	if err != nil {
 		return err
 	}
@@ -327,7 +886,9 @@ func (t *Target) requestFeatures() error {
 		// Fall back to fetching the EEPROM version with a separate request.
 		er, err := t.getEEPROMFromStatus()
 		if err != nil {
-			log.Printf("could not get EEPROM version: %v", err)
+			t.logger.Warn("could not get EEPROM version",
+				"method", "NewTarget",
+				"err", err)
 			er = &EEPROMVersion{}
 		}
 		t.supports = strings.Split(strings.TrimSpace(string(body)), ",")
@@ -350,6 +911,9 @@ func (t *Target) requestFeatures() error {
 
 const jsonMIME = "application/json"
 
+// fileHashHeader is set by targets which report the SHA256 of uploaded files.
+const fileHashHeader = "X-Gokrazy-File-Hash"
+
 // EEPROMVersion contains the signatures of a set of Raspberry Pi EEPROM files
 // (pieeprom.sig and vl805.sig). The signatures are sha256 sums (hexadecimal),
 // but you should treat them as opaque strings and only compare them.
@@ -359,10 +923,22 @@ type EEPROMVersion struct {
 }
 
 func (t *Target) getEEPROMFromStatus() (*EEPROMVersion, error) {
-	req, err := http.NewRequest("GET", t.baseURL, nil)
-	if err != nil {
+	var er struct {
+		EEPROM EEPROMVersion `json:"EEPROM"`
+	}
+	if err := t.getStatus(context.Background(), &er); err != nil {
 		return nil, err
 	}
+	return &er.EEPROM, nil
+}
+
+// getStatus fetches the JSON representation of the target’s status page and
+// decodes it into v.
+func (t *Target) getStatus(ctx context.Context, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", t.baseURL, nil)
+	if err != nil {
+		return err
+	}
 	// See
 	// https://github.com/gokrazy/gokrazy/commit/d7743d90caf04e03c1d51b2d2e4a6d6984026228
 	// for why send the Content-Type header.
@@ -370,27 +946,94 @@ func (t *Target) getEEPROMFromStatus() (*EEPROMVersion, error) {
 	// TODO(after 2024): remove Content-Type, send only Accept
 	req.Header.Set("Content-Type", jsonMIME)
 	req.Header.Set("Accept", jsonMIME)
-	resp, err := t.doer.Do(req)
+	resp, err := t.httpDoer().Do(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer resp.Body.Close()
 	if got, want := resp.StatusCode, http.StatusOK; got != want {
 		body, _ := ioutil.ReadAll(resp.Body)
-		return nil, fmt.Errorf("unexpected HTTP status code: got %d, want %d (body %q)", got, want, strings.TrimSpace(string(body)))
+		return fmt.Errorf("unexpected HTTP status code: got %d, want %d (body %q)", got, want, strings.TrimSpace(string(body)))
 	}
 	if got, want := resp.Header.Get("Content-Type"), jsonMIME; got != want {
-		return nil, fmt.Errorf("unexpected Content-Type: got %q, want %q", got, want)
+		return fmt.Errorf("unexpected Content-Type: got %q, want %q", got, want)
 	}
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("decoding response: %v", err)
 	}
+	return nil
+}
 
-	var er struct {
-		EEPROM EEPROMVersion `json:"EEPROM"`
+// statusError is returned when the target responds with an unexpected HTTP
+// status code.
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP status code: got %d, want %d (body %q)", e.code, http.StatusOK, e.body)
+}
+
+// doJSON sends a request with the JSON encoding of in (unless nil) as body to
+// path (relative to the base URL) and decodes the JSON response into out
+// (unless nil). A 404 Not Found response results in
+// ErrUpdateHandlerNotImplemented.
+func (t *Target) doJSON(ctx context.Context, method, path string, in, out interface{}) error {
+	return t.sendJSON(ctx, method, path, in, out, false)
+}
+
+// doUpdateJSON is like doJSON, but for requests which write to a partition, so
+// the update lock token is sent along (see setLockHeader).
+func (t *Target) doUpdateJSON(ctx context.Context, method, path string, in, out interface{}) error {
+	return t.sendJSON(ctx, method, path, in, out, true)
+}
+
+func (t *Target) sendJSON(ctx context.Context, method, path string, in, out interface{}, update bool) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, t.baseURL+path, body)
+	if err != nil {
+		return err
 	}
-	if err := json.Unmarshal(body, &er); err != nil {
-		return nil, fmt.Errorf("decoding response: %v", err)
+	if in != nil {
+		req.Header.Set("Content-Type", jsonMIME)
 	}
-	return &er.EEPROM, nil
+	req.Header.Set("Accept", jsonMIME)
+	if update {
+		t.setLockHeader(req)
+	}
+	resp, err := t.httpDoer().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrUpdateHandlerNotImplemented
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return &statusError{code: resp.StatusCode, body: strings.TrimSpace(string(body))}
+	}
+	if out == nil {
+		return nil
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		return fmt.Errorf("decoding response: %v", err)
+	}
+	return nil
 }
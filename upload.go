@@ -0,0 +1,83 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// multiPartWorkers is the maximum number of concurrent uploads of
+// MultiPartUpdate.
+const multiPartWorkers = 4
+
+// FileUpdate is a file to upload using MultiPartUpdate.
+type FileUpdate struct {
+	RemotePath string // e.g. uploadtemp/scan2drive/config.json
+	Content    []byte
+
+	// OnComplete, if non-nil, is called once all files were uploaded
+	// successfully, e.g. to Divert the corresponding service.
+	OnComplete func()
+}
+
+// MultiPartUpdate uploads all files concurrently (see Put) and then calls
+// their OnComplete hooks in order. If any upload fails, the files which were
+// already uploaded are deleted again and no hooks are called.
+func (t *Target) MultiPartUpdate(ctx context.Context, updates []FileUpdate) error {
+	uploadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, multiPartWorkers)
+		mu       sync.Mutex
+		errs     []error
+		uploaded []string
+	)
+	for _, u := range updates {
+		u := u // copy
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if uploadCtx.Err() != nil {
+				return // another upload failed
+			}
+			_, err := t.put(uploadCtx, u.RemotePath, bytes.NewReader(u.Content), int64(len(u.Content)))
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("uploading %s: %w", u.RemotePath, err))
+				cancel()
+				return
+			}
+			uploaded = append(uploaded, u.RemotePath)
+		}()
+	}
+	wg.Wait()
+
+	if len(errs) == 0 && ctx.Err() != nil {
+		errs = append(errs, ctx.Err())
+	}
+	if len(errs) > 0 {
+		// Roll back even if ctx was canceled, so that no partial set of files
+		// remains on the target.
+		rollbackCtx := context.WithoutCancel(ctx)
+		for _, path := range uploaded {
+			if err := t.doJSON(rollbackCtx, "DELETE", path, nil, nil); err != nil {
+				errs = append(errs, fmt.Errorf("rolling back %s: %w", path, err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	for _, u := range updates {
+		if u.OnComplete != nil {
+			u.OnComplete()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// Diff reports whether the content of the specified destination (root for the
+// currently inactive root partition, or boot) differs from the content of r,
+// i.e. whether an update is needed. The target hashes as many bytes of the
+// partition as r contains.
+func (t *Target) Diff(ctx context.Context, dest string, r io.Reader) (bool, error) {
+	hash := t.newUpdateHash()
+	n, err := io.Copy(hash, r)
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", t.baseURL+"update/"+dest+"/hash?size="+strconv.FormatInt(n, 10), nil)
+	if err != nil {
+		return false, err
+	}
+	if t.Supports(ProtocolFeatureUpdateHash) {
+		req.Header.Set("X-Gokrazy-Update-Hash", "crc32")
+	}
+	resp, err := t.httpDoer().Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, ErrUpdateHandlerNotImplemented
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	if got, want := resp.StatusCode, http.StatusOK; got != want {
+		return false, fmt.Errorf("unexpected HTTP status code: got %d, want %d (body %q)", got, want, string(body))
+	}
+	remoteHash, err := hex.DecodeString(string(bytes.TrimSpace(body)))
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Equal(remoteHash, hash.Sum(nil)), nil
+}
+
+// SwitchWithVerification verifies that the inactive root partition and the
+// boot partition contain root and boot, respectively, and only then calls
+// Switch. This prevents activating a stale or corrupt partition.
+func (t *Target) SwitchWithVerification(ctx context.Context, root, boot io.Reader) error {
+	for _, p := range []struct {
+		dest string
+		r    io.Reader
+	}{
+		{"root", root},
+		{"boot", boot},
+	} {
+		differs, err := t.Diff(ctx, p.dest, p.r)
+		if err != nil {
+			return fmt.Errorf("verifying %s: %w", p.dest, err)
+		}
+		if differs {
+			return fmt.Errorf("verifying %s: partition content does not match, not switching", p.dest)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return t.Switch()
+}